@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"doodocsbackendchallenge/internal/config"
 	"doodocsbackendchallenge/internal/delivery"
@@ -17,34 +20,90 @@ import (
 
 func main() {
 	const op = "main:"
-	log := logger.SetupLogger()
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		logger.SetupLogger(&config.Config{Log: config.DefaultLog()}).Error(err.Error(), slog.String("op", op))
+		os.Exit(2)
+	}
+	log := logger.SetupLogger(cfg)
+	// The standard log package, still used by the service, goes through the
+	// same handler and redaction.
+	slog.SetDefault(log)
 	log = log.With(
 		slog.String("op", op),
 	)
-	cfg, err := config.MustLoad()
+	log.Debug("config loaded", slog.Any("config", cfg))
+	// Without a mailer the email endpoints answer 503 and queued jobs wait
+	// for a restart with credentials.
+	var mailer service.Mailer
+	if err := cfg.CheckEmail(); err != nil {
+		log.Warn("email disabled", slog.String("reason", err.Error()))
+	} else if mailer, err = service.NewMailer(cfg); err != nil {
+		log.Error(err.Error())
+		return
+	}
+	jobs, err := service.OpenBoltJobStore(cfg.Jobs.DB)
 	if err != nil {
 		log.Error(err.Error())
 		return
 	}
-	services := service.NewServices(log, cfg)
-	handlers := delivery.NewHandler(services, log)
-	log.Debug("logger debug mode enabled")
-	server := new(server.Server)
-	log.Info("Starting server", slog.String("address", ":8080"))
+	defer jobs.Close()
+	templates, err := service.LoadTemplates(cfg.Mailer.TemplateDir)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	services := service.NewServices(log, cfg, mailer, jobs, templates)
+	runCtx, stopJobs := context.WithCancel(context.Background())
+	jobsDone := make(chan struct{})
 	go func() {
-		if err := server.Start(":8080", handlers.Handlers()); err != nil {
-		}
+		defer close(jobsDone)
+		services.Run(runCtx)
 	}()
+	handlers := delivery.NewHandler(services, log, cfg)
+	log.Debug("logger debug mode enabled")
+	server := &server.Server{Log: log}
+	log.Info("Starting server", slog.String("address", cfg.Server.Addr), slog.Bool("tls", cfg.Server.TLS.Enabled()))
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
-	log.Info("server started", op)
+	go func() {
+		if err := server.Start(cfg.Server, handlers.Handlers()); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("server failed", slog.String("error", err.Error()))
+			quit <- syscall.SIGTERM
+		}
+	}()
+	// SIGHUP rereads the secrets, e.g. after a mounted secret was rotated.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := cfg.ReloadSecrets(); err != nil {
+				log.Error(err.Error())
+				continue
+			}
+			log.Info("secrets reloaded")
+		}
+	}()
+	log.Info("server started")
 	<-quit
-	log.Info("stopping server", op)
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	log.Info("stopping server")
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
-		log.Error("failed to stop server", err.Error())
+		log.Error("failed to stop server", slog.String("error", err.Error()))
 		return
 	}
-	log.Info("server stopped", op)
+	stopJobs()
+	select {
+	case <-jobsDone:
+	case <-ctx.Done():
+		log.Error("email jobs still running, they resume on restart")
+	}
+	if closer, ok := mailer.(io.Closer); ok {
+		closer.Close()
+	}
+	log.Info("server stopped")
 }
@@ -2,16 +2,34 @@ module doodocsbackendchallenge
 
 go 1.22.6
 
-require golang.org/x/exp v0.0.0-20241108190413-2d47ceb2692f
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/bodgit/sevenzip v1.6.0
+	github.com/gabriel-vasile/mimetype v1.4.6
+	github.com/jordan-wright/email v4.0.1-0.20210109023952-943e75fe5223+incompatible
+	github.com/klauspost/compress v1.18.0
+	github.com/mocktools/go-smtp-mock v1.10.0
+	github.com/nwaples/rardecode/v2 v2.2.0
+	github.com/stretchr/testify v1.9.0
+	github.com/ulikunitz/xz v0.5.12
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/exp v0.0.0-20241108190413-2d47ceb2692f
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/bodgit/plumbing v1.3.0 // indirect
+	github.com/bodgit/windows v1.0.1 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/gabriel-vasile/mimetype v1.4.6 // indirect
-	github.com/jordan-wright/email v4.0.1-0.20210109023952-943e75fe5223+incompatible // indirect
-	github.com/mocktools/go-smtp-mock v1.10.0 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/objx v0.5.2 // indirect
-	github.com/stretchr/testify v1.9.0 // indirect
+	go4.org v0.0.0-20200411211856-f5505b9728dd // indirect
 	golang.org/x/net v0.30.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/sys v0.26.0 // indirect
+	golang.org/x/text v0.20.0 // indirect
 )
@@ -0,0 +1,8 @@
+package config
+
+// Admin guards the /admin endpoints. They answer 403 while Token is empty.
+// Token is a secret read from ADMIN_TOKEN, ADMIN_TOKEN_FILE or
+// ADMIN_TOKEN_ENCRYPTED_FILE.
+type Admin struct {
+	Token Secret `env:"ADMIN_TOKEN" yaml:"token" toml:"token" json:"token"`
+}
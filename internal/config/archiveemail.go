@@ -0,0 +1,54 @@
+package config
+
+import "fmt"
+
+// ArchiveEmail bounds POST /archiveandsendemail. The uploads and the
+// archive built from them stay in memory until the job is stored, and the
+// archive has to fit in a single email, so the defaults are tighter than
+// Limits. Sizes are in bytes.
+type ArchiveEmail struct {
+	MaxPartSize    int64 `env:"ARCHIVE_EMAIL_MAX_PART_SIZE" yaml:"max_part_size" toml:"max_part_size" json:"max_part_size"`
+	MaxRequestSize int64 `env:"ARCHIVE_EMAIL_MAX_REQUEST_SIZE" yaml:"max_request_size" toml:"max_request_size" json:"max_request_size"`
+	MaxArchiveSize int64 `env:"ARCHIVE_EMAIL_MAX_ARCHIVE_SIZE" yaml:"max_archive_size" toml:"max_archive_size" json:"max_archive_size"`
+}
+
+const (
+	defaultArchiveEmailMaxPartSize    = 10 << 20
+	defaultArchiveEmailMaxRequestSize = 25 << 20
+	defaultArchiveEmailMaxArchiveSize = 20 << 20
+)
+
+func DefaultArchiveEmail() ArchiveEmail {
+	return ArchiveEmail{
+		MaxPartSize:    defaultArchiveEmailMaxPartSize,
+		MaxRequestSize: defaultArchiveEmailMaxRequestSize,
+		MaxArchiveSize: defaultArchiveEmailMaxArchiveSize,
+	}
+}
+
+// Limits are the upload limits of the endpoint.
+func (a ArchiveEmail) Limits() Limits {
+	return Limits{MaxPartSize: a.MaxPartSize, MaxRequestSize: a.MaxRequestSize}
+}
+
+func (a ArchiveEmail) validate() error {
+	if err := a.Limits().validate("archive_email"); err != nil {
+		return err
+	}
+	if a.MaxArchiveSize <= 0 {
+		return fmt.Errorf("archive_email.max_archive_size must be positive, got %d", a.MaxArchiveSize)
+	}
+	return nil
+}
+
+func applyArchiveEmailEnv(a *ArchiveEmail) error {
+	var err error
+	if a.MaxPartSize, err = getEnvInt64("ARCHIVE_EMAIL_MAX_PART_SIZE", a.MaxPartSize); err != nil {
+		return err
+	}
+	if a.MaxRequestSize, err = getEnvInt64("ARCHIVE_EMAIL_MAX_REQUEST_SIZE", a.MaxRequestSize); err != nil {
+		return err
+	}
+	a.MaxArchiveSize, err = getEnvInt64("ARCHIVE_EMAIL_MAX_ARCHIVE_SIZE", a.MaxArchiveSize)
+	return err
+}
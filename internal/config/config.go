@@ -1,24 +1,312 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Email    string `env:"EMAIL"`
-	Password string `env:"PASSWORD"`
+	Server       Server       `yaml:"server" toml:"server" json:"server"`
+	Log          Log          `yaml:"log" toml:"log" json:"log"`
+	Email        string       `env:"EMAIL" yaml:"-" toml:"-" json:"-"`
+	Password     Secret       `env:"PASSWORD" yaml:"password" toml:"password" json:"password"`
+	Limits       Limits       `yaml:"limits" toml:"limits" json:"limits"`
+	Mime         MimePolicies `yaml:"mime" toml:"mime" json:"mime"`
+	SMTP         SMTP         `yaml:"smtp" toml:"smtp" json:"smtp"`
+	Mailer       Mailer       `yaml:"mailer" toml:"mailer" json:"mailer"`
+	Jobs         Jobs         `yaml:"jobs" toml:"jobs" json:"jobs"`
+	ArchiveEmail ArchiveEmail `yaml:"archive_email" toml:"archive_email" json:"archive_email"`
+	Admin        Admin        `yaml:"admin" toml:"admin" json:"admin"`
+
+	providers map[string]SecretProvider
 }
 
-func MustLoad() (*Config, error) {
-	const op = "config.MustLoad"
-	email, password := os.Getenv("EMAIL"), os.Getenv("PASSWORD")
-	if email == "" || password == "" {
-		return nil, fmt.Errorf("%s: nil email or password", op)
+// Limits bounds the size of multipart uploads. Sizes are in bytes.
+type Limits struct {
+	MaxPartSize    int64 `env:"MAX_PART_SIZE" yaml:"max_part_size" toml:"max_part_size" json:"max_part_size"`
+	MaxRequestSize int64 `env:"MAX_REQUEST_SIZE" yaml:"max_request_size" toml:"max_request_size" json:"max_request_size"`
+}
+
+const (
+	defaultMaxPartSize    = 32 << 20
+	defaultMaxRequestSize = 128 << 20
+)
+
+// Load builds the config in layers, each overriding the one before:
+// defaults, the YAML, TOML or JSON file named by -config or CONFIG_PATH,
+// env vars and then the command-line flags in args. Every section is
+// validated once all layers are applied. Missing email credentials are not
+// an error, see CheckEmail.
+func Load(args []string) (*Config, error) {
+	const op = "config.Load"
+	// The file is named on the command line, so the flags are parsed twice:
+	// first for -config, then over the file and env values so they win.
+	path := os.Getenv("CONFIG_PATH")
+	scratch := defaults()
+	if err := newFlagSet(&scratch, &path).Parse(args); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	cfg := defaults()
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err := applyEnv(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	cfg := Config{
-		Email:    email,
-		Password: password,
+	flags := newFlagSet(&cfg, &path)
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	cfg.SMTP.Username = cfg.SMTPUsername()
+	if cfg.SMTP.From == "" {
+		cfg.SMTP.From = cfg.SMTP.Username
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 	return &cfg, nil
 }
+
+// MustLoad is Load without command-line flags.
+func MustLoad() (*Config, error) {
+	return Load(nil)
+}
+
+func defaults() Config {
+	return Config{
+		Server:       DefaultServer(),
+		Log:          DefaultLog(),
+		Limits:       DefaultLimits(),
+		Mime:         DefaultMimePolicies(),
+		SMTP:         DefaultSMTP(),
+		Mailer:       DefaultMailer(),
+		Jobs:         DefaultJobs(),
+		ArchiveEmail: DefaultArchiveEmail(),
+	}
+}
+
+func applyEnv(cfg *Config) error {
+	cfg.Email = os.Getenv("EMAIL")
+	if err := cfg.loadSecrets(); err != nil {
+		return err
+	}
+	if err := applyServerEnv(&cfg.Server); err != nil {
+		return err
+	}
+	applyLogEnv(&cfg.Log)
+	var err error
+	if cfg.Limits.MaxPartSize, err = getEnvInt64("MAX_PART_SIZE", cfg.Limits.MaxPartSize); err != nil {
+		return err
+	}
+	if cfg.Limits.MaxRequestSize, err = getEnvInt64("MAX_REQUEST_SIZE", cfg.Limits.MaxRequestSize); err != nil {
+		return err
+	}
+	applyMimeEnv(&cfg.Mime)
+	if err := applySMTPEnv(&cfg.SMTP); err != nil {
+		return err
+	}
+	if err := applyMailerEnv(&cfg.Mailer); err != nil {
+		return err
+	}
+	applyJobsEnv(&cfg.Jobs)
+	if err := applyArchiveEmailEnv(&cfg.ArchiveEmail); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate checks every section and reports all the problems at once.
+// Enumerated values such as the SMTP TLS mode are lower-cased.
+func (c *Config) Validate() error {
+	return errors.Join(
+		c.Server.validate(),
+		c.Log.validate(),
+		c.Limits.validate("limits"),
+		c.SMTP.validate(),
+		c.Mailer.validate(),
+		c.ArchiveEmail.validate(),
+	)
+}
+
+// CheckEmail reports why email cannot be sent with this config, or nil if
+// it can. Without email the archive endpoints keep working.
+func (c *Config) CheckEmail() error {
+	if c.SMTP.From == "" && c.SMTPUsername() == "" {
+		return errors.New("no sender address: set smtp.from, smtp.username or EMAIL")
+	}
+	if c.Mailer.Backend == MailerSMTP && c.SMTP.Auth != SMTPAuthNone && (c.SMTPUsername() == "" || c.Password.Value() == "") {
+		return errors.New("SMTP credentials are missing: set smtp.username or EMAIL, and PASSWORD or PASSWORD_FILE")
+	}
+	return nil
+}
+
+// SMTPUsername is the SMTP login: smtp.username, or EMAIL when unset.
+func (c *Config) SMTPUsername() string {
+	if c.SMTP.Username != "" {
+		return c.SMTP.Username
+	}
+	return c.Email
+}
+
+// loadFile overlays a YAML, TOML or JSON file onto cfg, chosen by the
+// extension; keys missing from the file keep their current values.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = unmarshalJSON(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		err = yaml.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// unmarshalJSON is json.Unmarshal that also takes durations spelled as in
+// YAML and TOML, e.g. "30s"; encoding/json only knows nanoseconds.
+func unmarshalJSON(data []byte, cfg *Config) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw any
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	if err := jsonDurations(raw, reflect.TypeOf(cfg)); err != nil {
+		return err
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, cfg)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// jsonDurations replaces the duration strings in v, decoded JSON meant for
+// a value of type t, with nanoseconds.
+func jsonDurations(v any, t reflect.Type) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			// encoding/json matches keys regardless of case.
+			for key, value := range obj {
+				if !strings.EqualFold(key, name) {
+					continue
+				}
+				if field.Type != durationType {
+					if err := jsonDurations(value, field.Type); err != nil {
+						return fmt.Errorf("%s.%w", key, err)
+					}
+					continue
+				}
+				if s, ok := value.(string); ok {
+					d, err := time.ParseDuration(s)
+					if err != nil {
+						return fmt.Errorf("%s: must be a duration such as 2s, got %q", key, s)
+					}
+					obj[key] = int64(d)
+				}
+			}
+		}
+	case reflect.Map:
+		obj, _ := v.(map[string]any)
+		for key, value := range obj {
+			if err := jsonDurations(value, t.Elem()); err != nil {
+				return fmt.Errorf("%s.%w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// DefaultLimits returns the limits used when none are configured.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxPartSize:    defaultMaxPartSize,
+		MaxRequestSize: defaultMaxRequestSize,
+	}
+}
+
+func (l Limits) validate(section string) error {
+	if l.MaxPartSize <= 0 || l.MaxRequestSize <= 0 {
+		return fmt.Errorf("%s: sizes must be positive, got part %d and request %d", section, l.MaxPartSize, l.MaxRequestSize)
+	}
+	return nil
+}
+
+func getEnvInt64(key string, fallback int64) (int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number of bytes, got %q", key, value)
+	}
+	return n, nil
+}
+
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration such as 2s, got %q", key, value)
+	}
+	return d, nil
+}
+
+// getEnvList splits a comma-separated env var; ok is false when it is unset.
+func getEnvList(key string) ([]string, bool) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return nil, false
+	}
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list, true
+}
@@ -0,0 +1,394 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMimePolicyAllows(t *testing.T) {
+	policy := MimePolicy{
+		Allow: []string{"image/*", "application/pdf"},
+		Deny:  []string{"image/svg+xml"},
+	}
+	tests := []struct {
+		mtype string
+		want  bool
+	}{
+		{mtype: "image/png", want: true},
+		{mtype: "IMAGE/JPEG", want: true},
+		{mtype: "application/pdf", want: true},
+		{mtype: "text/plain; charset=utf-8", want: false},
+		{mtype: "image/svg+xml", want: false},
+		{mtype: "imagex/png", want: false},
+		{mtype: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mtype, func(t *testing.T) {
+			assert.Equal(t, tt.want, policy.Allows(tt.mtype))
+		})
+	}
+
+	assert.True(t, MimePolicy{Allow: []string{"*/*"}}.Allows("application/x-anything"))
+	assert.False(t, MimePolicy{}.Allows("image/png"))
+}
+
+func TestMustLoadMimePolicies(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+mime:
+  archive:
+    allow: ["image/*"]
+    deny: ["image/gif"]
+`), 0o600))
+
+	t.Setenv("EMAIL", "sender@example.com")
+	t.Setenv("PASSWORD", "secret")
+	t.Setenv("CONFIG_PATH", path)
+	t.Setenv("EMAIL_MIME_ALLOW", "application/pdf, text/*")
+
+	cfg, err := MustLoad()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"image/*"}, cfg.Mime.Archive.Allow)
+	assert.Equal(t, []string{"image/gif"}, cfg.Mime.Archive.Deny)
+	assert.Equal(t, []string{"application/pdf", "text/*"}, cfg.Mime.Email.Allow)
+	assert.Equal(t, DefaultMimePolicies().Upload, cfg.Mime.Upload)
+}
+
+func TestMustLoadJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"mime": {"email": {"allow": ["application/pdf"]}}}`), 0o600))
+
+	t.Setenv("EMAIL", "sender@example.com")
+	t.Setenv("PASSWORD", "secret")
+	t.Setenv("CONFIG_PATH", path)
+
+	cfg, err := MustLoad()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"application/pdf"}, cfg.Mime.Email.Allow)
+	assert.Equal(t, DefaultMimePolicies().Archive, cfg.Mime.Archive)
+}
+
+func TestLoadJSONDurations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+	"server": {
+		"read_timeout": "30s",
+		"idle_timeout": 5000000000,
+		"routes": {"/api/v1/archive/files": {"chunk_write_timeout": "1m"}}
+	},
+	"mailer": {"retry": {"base_delay": "2s", "max_delay": "1m30s"}}
+}`), 0o600))
+	t.Setenv("CONFIG_PATH", path)
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.Server.ReadTimeout)
+	// Наносекунды по-прежнему принимаются.
+	assert.Equal(t, 5*time.Second, cfg.Server.IdleTimeout)
+	assert.Equal(t, RouteTimeouts{ChunkWriteTimeout: time.Minute}, cfg.Server.Routes["/api/v1/archive/files"])
+	assert.Equal(t, 2*time.Second, cfg.Mailer.Retry.BaseDelay)
+	assert.Equal(t, 90*time.Second, cfg.Mailer.Retry.MaxDelay)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"server": {"routes": {"/api/v1/archive/files": {"read_timeout": "soon"}}}}`), 0o600))
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, `routes./api/v1/archive/files.read_timeout: must be a duration such as 2s, got "soon"`)
+}
+
+func TestMustLoadSMTP(t *testing.T) {
+	t.Setenv("EMAIL", "sender@example.com")
+	t.Setenv("PASSWORD", "secret")
+
+	cfg, err := MustLoad()
+	require.NoError(t, err)
+	assert.Equal(t, "smtp.gmail.com:587", cfg.SMTP.Addr())
+	assert.Equal(t, SMTPTLSStartTLS, cfg.SMTP.TLSMode)
+	assert.Equal(t, "sender@example.com", cfg.SMTP.From)
+
+	t.Setenv("SMTP_HOST", "relay.internal")
+	t.Setenv("SMTP_PORT", "465")
+	t.Setenv("SMTP_TLS", "TLS")
+	t.Setenv("SMTP_AUTH", "cram-md5")
+	t.Setenv("SMTP_FROM", "noreply@example.com")
+	cfg, err = MustLoad()
+	require.NoError(t, err)
+	assert.Equal(t, SMTP{
+		Host:     "relay.internal",
+		Port:     465,
+		TLSMode:  SMTPTLSImplicit,
+		Auth:     SMTPAuthCRAMMD5,
+		From:     "noreply@example.com",
+		Username: "sender@example.com",
+	}, cfg.SMTP)
+
+	t.Setenv("SMTP_AUTH", "xoauth2")
+	_, err = MustLoad()
+	assert.Error(t, err)
+}
+
+func TestMustLoadMailRetry(t *testing.T) {
+	t.Setenv("EMAIL", "sender@example.com")
+	t.Setenv("PASSWORD", "secret")
+
+	cfg, err := MustLoad()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultMailer().Retry, cfg.Mailer.Retry)
+
+	t.Setenv("MAIL_RETRY_ATTEMPTS", "3")
+	t.Setenv("MAIL_RETRY_BASE_DELAY", "250ms")
+	t.Setenv("MAIL_RETRY_MAX_DELAY", "10s")
+	cfg, err = MustLoad()
+	require.NoError(t, err)
+	assert.Equal(t, MailRetry{Attempts: 3, BaseDelay: 250 * time.Millisecond, MaxDelay: 10 * time.Second}, cfg.Mailer.Retry)
+
+	t.Setenv("MAIL_RETRY_MAX_DELAY", "100ms")
+	_, err = MustLoad()
+	assert.Error(t, err, "max below base")
+
+	t.Setenv("MAIL_RETRY_MAX_DELAY", "10s")
+	t.Setenv("MAIL_RETRY_ATTEMPTS", "0")
+	_, err = MustLoad()
+	assert.Error(t, err)
+}
+
+func TestMustLoadArchiveEmail(t *testing.T) {
+	t.Setenv("EMAIL", "sender@example.com")
+	t.Setenv("PASSWORD", "secret")
+
+	cfg, err := MustLoad()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultArchiveEmail(), cfg.ArchiveEmail)
+
+	t.Setenv("ARCHIVE_EMAIL_MAX_PART_SIZE", "1024")
+	t.Setenv("ARCHIVE_EMAIL_MAX_ARCHIVE_SIZE", "4096")
+	cfg, err = MustLoad()
+	require.NoError(t, err)
+	assert.Equal(t, Limits{MaxPartSize: 1024, MaxRequestSize: defaultArchiveEmailMaxRequestSize}, cfg.ArchiveEmail.Limits())
+	assert.Equal(t, int64(4096), cfg.ArchiveEmail.MaxArchiveSize)
+
+	t.Setenv("ARCHIVE_EMAIL_MAX_ARCHIVE_SIZE", "-1")
+	_, err = MustLoad()
+	assert.Error(t, err)
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+server:
+  addr: ":9000"
+  read_timeout: 30s
+  write_timeout: 1m
+log:
+  level: info
+limits:
+  max_part_size: 1024
+`), 0o600))
+
+	// Файл перекрывает значения по умолчанию, env — файл, флаги — env.
+	t.Setenv("HTTP_ADDR", ":9100")
+	t.Setenv("LOG_LEVEL", "warn")
+	cfg, err := Load([]string{"-config", path, "-addr", ":9200", "-log-format", "TEXT"})
+	require.NoError(t, err)
+	want := DefaultServer()
+	want.Addr, want.ReadTimeout, want.WriteTimeout = ":9200", 30*time.Second, time.Minute
+	assert.Equal(t, want, cfg.Server)
+	assert.Equal(t, Log{Level: "warn", Format: LogFormatText}, cfg.Log)
+	assert.Equal(t, Limits{MaxPartSize: 1024, MaxRequestSize: defaultMaxRequestSize}, cfg.Limits)
+
+	_, err = Load([]string{"-no-such-flag"})
+	assert.Error(t, err)
+}
+
+func TestLoadTOMLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+[server]
+addr = "127.0.0.1:8081"
+write_timeout = "45s"
+
+[smtp]
+host = "relay.internal"
+port = 2525
+
+[mime.email]
+allow = ["application/pdf"]
+`), 0o600))
+	t.Setenv("CONFIG_PATH", path)
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8081", cfg.Server.Addr)
+	assert.Equal(t, 45*time.Second, cfg.Server.WriteTimeout)
+	assert.Equal(t, "relay.internal:2525", cfg.SMTP.Addr())
+	assert.Equal(t, []string{"application/pdf"}, cfg.Mime.Email.Allow)
+}
+
+func TestLoadValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"Пустой адрес", []string{"-addr", ""}, "server.addr"},
+		{"Отрицательный таймаут", []string{"-read-timeout", "-1s"}, "server.read_timeout"},
+		{"Неизвестный уровень логов", []string{"-log-level", "loud"}, "log.level"},
+		{"Неизвестный формат логов", []string{"-log-format", "xml"}, "log.format"},
+		{"Нулевой лимит", []string{"-max-part-size", "0"}, "limits"},
+		{"Неверный порт SMTP", []string{"-smtp-port", "70000"}, "smtp.port"},
+		{"Неизвестный бэкенд", []string{"-mailer", "pigeon"}, "mailer.backend"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+
+	// Ошибки всех секций сообщаются вместе.
+	_, err := Load([]string{"-log-format", "xml", "-mailer", "pigeon"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "log.format")
+	assert.Contains(t, err.Error(), "mailer.backend")
+}
+
+func TestCheckEmail(t *testing.T) {
+	// Без учётных данных сервер запускается, но почта выключена.
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Error(t, cfg.CheckEmail())
+
+	t.Setenv("EMAIL", "sender@example.com")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.Error(t, cfg.CheckEmail(), "нет пароля")
+
+	cfg, err = Load([]string{"-smtp-auth", "none"})
+	require.NoError(t, err)
+	assert.NoError(t, cfg.CheckEmail(), "релею без авторизации пароль не нужен")
+
+	t.Setenv("PASSWORD", "secret")
+	cfg, err = Load(nil)
+	require.NoError(t, err)
+	assert.NoError(t, cfg.CheckEmail())
+
+	cfg = &Config{Mailer: Mailer{Backend: MailerFile, DropDir: t.TempDir()}}
+	assert.Error(t, cfg.CheckEmail(), "нет адреса отправителя")
+	cfg.SMTP.From = "noreply@example.com"
+	assert.NoError(t, cfg.CheckEmail())
+}
+
+func TestLoadSMTPUsername(t *testing.T) {
+	t.Setenv("PASSWORD", "secret")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+smtp:
+  username: file@example.com
+`), 0o600))
+
+	// Логин задаётся без EMAIL: из файла, env или флага, и служит адресом отправителя.
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"Из файла", map[string]string{"CONFIG_PATH": path}, nil, "file@example.com"},
+		{"Env перекрывает файл", map[string]string{"CONFIG_PATH": path, "SMTP_USERNAME": "env@example.com"}, nil, "env@example.com"},
+		{"Флаг перекрывает env", map[string]string{"SMTP_USERNAME": "env@example.com"}, []string{"-smtp-user", "flag@example.com"}, "flag@example.com"},
+		{"По умолчанию EMAIL", map[string]string{"EMAIL": "email@example.com"}, nil, "email@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			cfg, err := Load(tt.args)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg.SMTP.Username)
+			assert.Equal(t, tt.want, cfg.SMTP.From)
+			assert.NoError(t, cfg.CheckEmail())
+		})
+	}
+}
+
+func TestLoadRouteTimeouts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+server:
+  max_header_bytes: 4096
+  routes:
+    /api/v1/archive/files:
+      write_timeout: 20m
+      chunk_write_timeout: 1m
+    /api/v1/jobs/{id}:
+      read_timeout: 5s
+`), 0o600))
+	t.Setenv("CONFIG_PATH", path)
+	t.Setenv("HTTP_IDLE_TIMEOUT", "30s")
+
+	cfg, err := Load([]string{"-read-header-timeout", "2s"})
+	require.NoError(t, err)
+	assert.Equal(t, 4096, cfg.Server.MaxHeaderBytes)
+	assert.Equal(t, 30*time.Second, cfg.Server.IdleTimeout)
+	assert.Equal(t, 2*time.Second, cfg.Server.ReadHeaderTimeout)
+	// Маршрут из файла заменяет значения по умолчанию целиком, остальные остаются.
+	assert.Equal(t, RouteTimeouts{WriteTimeout: 20 * time.Minute, ChunkWriteTimeout: time.Minute}, cfg.Server.Routes["/api/v1/archive/files"])
+	assert.Equal(t, RouteTimeouts{ReadTimeout: 5 * time.Second}, cfg.Server.Routes["/api/v1/jobs/{id}"])
+	assert.Equal(t, DefaultServer().Routes["/api/v1/mail/file"], cfg.Server.Routes["/api/v1/mail/file"])
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+server:
+  routes:
+    archive/files:
+      read_timeout: 1m
+`), 0o600))
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "is not a path")
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+server:
+  routes:
+    /api/v1/archive/files:
+      chunk_write_timeout: -1s
+`), 0o600))
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "chunk_write_timeout")
+}
+
+func TestLoadTLS(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "/etc/tls/cert.pem")
+	t.Setenv("TLS_KEY_FILE", "/etc/tls/key.pem")
+
+	cfg, err := Load([]string{"-tls-client-ca", "/etc/tls/ca.pem", "-tls-redirect-addr", ":8081"})
+	require.NoError(t, err)
+	assert.True(t, cfg.Server.TLS.Enabled())
+	assert.Equal(t, TLS{
+		CertFile:     "/etc/tls/cert.pem",
+		KeyFile:      "/etc/tls/key.pem",
+		ClientCAFile: "/etc/tls/ca.pem",
+		RedirectAddr: ":8081",
+	}, cfg.Server.TLS)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"Сертификат без ключа", []string{"-tls-key", ""}},
+		{"Ключ без сертификата", []string{"-tls-cert", ""}},
+		{"mTLS без TLS", []string{"-tls-cert", "", "-tls-key", "", "-tls-client-ca", "/etc/tls/ca.pem"}},
+		{"Редирект без TLS", []string{"-tls-cert", "", "-tls-key", "", "-tls-redirect-addr", ":8081"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.args)
+			assert.ErrorContains(t, err, "server.tls")
+		})
+	}
+}
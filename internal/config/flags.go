@@ -0,0 +1,33 @@
+package config
+
+import "flag"
+
+// newFlagSet binds the command-line flags to cfg, using its current values
+// as defaults, so a flag that is not given leaves its field alone.
+func newFlagSet(cfg *Config, path *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("doodocs", flag.ContinueOnError)
+	fs.StringVar(path, "config", *path, "YAML, TOML or JSON config file (env CONFIG_PATH)")
+	fs.StringVar(&cfg.Server.Addr, "addr", cfg.Server.Addr, "listen address (env HTTP_ADDR)")
+	fs.DurationVar(&cfg.Server.ReadTimeout, "read-timeout", cfg.Server.ReadTimeout, "request read timeout (env HTTP_READ_TIMEOUT)")
+	fs.DurationVar(&cfg.Server.ReadHeaderTimeout, "read-header-timeout", cfg.Server.ReadHeaderTimeout, "request header read timeout (env HTTP_READ_HEADER_TIMEOUT)")
+	fs.DurationVar(&cfg.Server.WriteTimeout, "write-timeout", cfg.Server.WriteTimeout, "response write timeout (env HTTP_WRITE_TIMEOUT)")
+	fs.DurationVar(&cfg.Server.IdleTimeout, "idle-timeout", cfg.Server.IdleTimeout, "keep-alive idle timeout (env HTTP_IDLE_TIMEOUT)")
+	fs.IntVar(&cfg.Server.MaxHeaderBytes, "max-header-bytes", cfg.Server.MaxHeaderBytes, "largest request header in bytes (env HTTP_MAX_HEADER_BYTES)")
+	fs.DurationVar(&cfg.Server.ShutdownTimeout, "shutdown-timeout", cfg.Server.ShutdownTimeout, "graceful shutdown timeout (env HTTP_SHUTDOWN_TIMEOUT)")
+	fs.StringVar(&cfg.Server.TLS.CertFile, "tls-cert", cfg.Server.TLS.CertFile, "TLS certificate chain, PEM (env TLS_CERT_FILE)")
+	fs.StringVar(&cfg.Server.TLS.KeyFile, "tls-key", cfg.Server.TLS.KeyFile, "TLS private key, PEM (env TLS_KEY_FILE)")
+	fs.StringVar(&cfg.Server.TLS.ClientCAFile, "tls-client-ca", cfg.Server.TLS.ClientCAFile, "require client certificates signed by these CAs, PEM (env TLS_CLIENT_CA_FILE)")
+	fs.StringVar(&cfg.Server.TLS.RedirectAddr, "tls-redirect-addr", cfg.Server.TLS.RedirectAddr, "plain HTTP listener redirecting to HTTPS (env TLS_REDIRECT_ADDR)")
+	fs.Int64Var(&cfg.Limits.MaxPartSize, "max-part-size", cfg.Limits.MaxPartSize, "largest upload part in bytes (env MAX_PART_SIZE)")
+	fs.Int64Var(&cfg.Limits.MaxRequestSize, "max-request-size", cfg.Limits.MaxRequestSize, "largest request body in bytes (env MAX_REQUEST_SIZE)")
+	fs.StringVar(&cfg.Mailer.Backend, "mailer", cfg.Mailer.Backend, "smtp, sendmail or file (env MAILER)")
+	fs.StringVar(&cfg.SMTP.Host, "smtp-host", cfg.SMTP.Host, "SMTP relay host (env SMTP_HOST)")
+	fs.IntVar(&cfg.SMTP.Port, "smtp-port", cfg.SMTP.Port, "SMTP relay port (env SMTP_PORT)")
+	fs.StringVar(&cfg.SMTP.TLSMode, "smtp-tls", cfg.SMTP.TLSMode, "starttls, tls or none (env SMTP_TLS)")
+	fs.StringVar(&cfg.SMTP.Auth, "smtp-auth", cfg.SMTP.Auth, "plain, login, cram-md5 or none (env SMTP_AUTH)")
+	fs.StringVar(&cfg.SMTP.Username, "smtp-user", cfg.SMTP.Username, "SMTP login, EMAIL by default (env SMTP_USERNAME)")
+	fs.StringVar(&cfg.SMTP.From, "smtp-from", cfg.SMTP.From, "From address, the SMTP login by default (env SMTP_FROM)")
+	fs.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "debug, info, warn or error (env LOG_LEVEL)")
+	fs.StringVar(&cfg.Log.Format, "log-format", cfg.Log.Format, "json or text (env LOG_FORMAT)")
+	return fs
+}
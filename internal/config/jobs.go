@@ -0,0 +1,20 @@
+package config
+
+import "os"
+
+// Jobs configures the background job queue. DB is the BoltDB file that
+// keeps queued jobs and their attachments across restarts.
+type Jobs struct {
+	DB string `env:"JOBS_DB" yaml:"db" toml:"db" json:"db"`
+}
+
+// DefaultJobs keeps the queue next to the binary.
+func DefaultJobs() Jobs {
+	return Jobs{DB: "jobs.db"}
+}
+
+func applyJobsEnv(j *Jobs) {
+	if path := os.Getenv("JOBS_DB"); path != "" {
+		j.DB = path
+	}
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Log formats.
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// Log configures the process logger. Level is one of debug, info, warn or
+// error.
+type Log struct {
+	Level  string `env:"LOG_LEVEL" yaml:"level" toml:"level" json:"level"`
+	Format string `env:"LOG_FORMAT" yaml:"format" toml:"format" json:"format"`
+}
+
+// DefaultLog logs everything as JSON, as the service always has.
+func DefaultLog() Log {
+	return Log{Level: "debug", Format: LogFormatJSON}
+}
+
+// SlogLevel is Level for log/slog; validate has checked it parses.
+func (l Log) SlogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+func applyLogEnv(l *Log) {
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		l.Level = level
+	}
+	if format := os.Getenv("LOG_FORMAT"); format != "" {
+		l.Format = format
+	}
+}
+
+// validate checks the logger and lower-cases the format.
+func (l *Log) validate() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return fmt.Errorf("log.level must be debug, info, warn or error, got %q", l.Level)
+	}
+	l.Format = strings.ToLower(l.Format)
+	switch l.Format {
+	case LogFormatJSON, LogFormatText:
+	default:
+		return fmt.Errorf("log.format must be json or text, got %q", l.Format)
+	}
+	return nil
+}
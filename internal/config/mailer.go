@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mailer backends.
+const (
+	MailerSMTP     = "smtp"
+	MailerSendmail = "sendmail"
+	MailerFile     = "file"
+)
+
+// Mailer selects how outgoing email leaves the service. The file backend
+// drops .eml files into DropDir for staging and integration tests.
+// TemplateDir holds the email templates, see service.LoadTemplates. Workers
+// bounds how many messages are sent at once and, for SMTP, how many
+// sessions are kept open.
+type Mailer struct {
+	Backend     string    `env:"MAILER" yaml:"backend" toml:"backend" json:"backend"`
+	Sendmail    string    `env:"SENDMAIL_PATH" yaml:"sendmail" toml:"sendmail" json:"sendmail"`
+	DropDir     string    `env:"MAIL_DROP_DIR" yaml:"drop_dir" toml:"drop_dir" json:"drop_dir"`
+	Workers     int       `env:"MAIL_WORKERS" yaml:"workers" toml:"workers" json:"workers"`
+	Retry       MailRetry `yaml:"retry" toml:"retry" json:"retry"`
+	TemplateDir string    `env:"MAIL_TEMPLATE_DIR" yaml:"template_dir" toml:"template_dir" json:"template_dir"`
+}
+
+// MailRetry bounds retries of temporary delivery failures. The wait before
+// retry n is BaseDelay*2^(n-1), capped at MaxDelay, with jitter.
+type MailRetry struct {
+	Attempts  int           `env:"MAIL_RETRY_ATTEMPTS" yaml:"attempts" toml:"attempts" json:"attempts"`
+	BaseDelay time.Duration `env:"MAIL_RETRY_BASE_DELAY" yaml:"base_delay" toml:"base_delay" json:"base_delay"`
+	MaxDelay  time.Duration `env:"MAIL_RETRY_MAX_DELAY" yaml:"max_delay" toml:"max_delay" json:"max_delay"`
+}
+
+const defaultMailWorkers = 4
+
+// DefaultMailer sends through SMTP.
+func DefaultMailer() Mailer {
+	return Mailer{
+		Backend:  MailerSMTP,
+		Sendmail: "/usr/sbin/sendmail",
+		Workers:  defaultMailWorkers,
+		Retry: MailRetry{
+			Attempts:  5,
+			BaseDelay: time.Second,
+			MaxDelay:  time.Minute,
+		},
+	}
+}
+
+// applyMailerEnv overrides the mailer from env vars.
+func applyMailerEnv(m *Mailer) error {
+	if backend := os.Getenv("MAILER"); backend != "" {
+		m.Backend = backend
+	}
+	if path := os.Getenv("SENDMAIL_PATH"); path != "" {
+		m.Sendmail = path
+	}
+	if dir := os.Getenv("MAIL_DROP_DIR"); dir != "" {
+		m.DropDir = dir
+	}
+	if dir := os.Getenv("MAIL_TEMPLATE_DIR"); dir != "" {
+		m.TemplateDir = dir
+	}
+	if value := os.Getenv("MAIL_WORKERS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("MAIL_WORKERS must be a number, got %q", value)
+		}
+		m.Workers = n
+	}
+	return applyMailRetryEnv(&m.Retry)
+}
+
+// validate checks the mailer and lower-cases the backend.
+func (m *Mailer) validate() error {
+	if m.Workers <= 0 {
+		return fmt.Errorf("mailer.workers must be positive, got %d", m.Workers)
+	}
+	if err := m.Retry.validate(); err != nil {
+		return err
+	}
+	m.Backend = strings.ToLower(m.Backend)
+	switch m.Backend {
+	case MailerSMTP:
+	case MailerSendmail:
+		if m.Sendmail == "" {
+			return fmt.Errorf("mailer.sendmail is required for the sendmail mailer")
+		}
+	case MailerFile:
+		if m.DropDir == "" {
+			return fmt.Errorf("mailer.drop_dir is required for the file mailer")
+		}
+	default:
+		return fmt.Errorf("mailer.backend must be smtp, sendmail or file, got %q", m.Backend)
+	}
+	return nil
+}
+
+func applyMailRetryEnv(r *MailRetry) error {
+	if value := os.Getenv("MAIL_RETRY_ATTEMPTS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("MAIL_RETRY_ATTEMPTS must be a number, got %q", value)
+		}
+		r.Attempts = n
+	}
+	for key, d := range map[string]*time.Duration{
+		"MAIL_RETRY_BASE_DELAY": &r.BaseDelay,
+		"MAIL_RETRY_MAX_DELAY":  &r.MaxDelay,
+	} {
+		if value := os.Getenv(key); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%s must be a duration such as 2s, got %q", key, value)
+			}
+			*d = parsed
+		}
+	}
+	return nil
+}
+
+func (r MailRetry) validate() error {
+	if r.Attempts < 1 {
+		return fmt.Errorf("mailer.retry.attempts must be at least 1, got %d", r.Attempts)
+	}
+	if r.BaseDelay < 0 || r.MaxDelay < r.BaseDelay {
+		return fmt.Errorf("mailer.retry delays must satisfy 0 <= base (%s) <= max (%s)", r.BaseDelay, r.MaxDelay)
+	}
+	return nil
+}
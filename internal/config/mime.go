@@ -0,0 +1,94 @@
+package config
+
+import (
+	"strings"
+)
+
+// MimePolicy decides which content types an endpoint accepts. Entries may
+// be exact types, "type/*" wildcards or "*/*". Deny wins over allow.
+type MimePolicy struct {
+	Allow []string `yaml:"allow" toml:"allow" json:"allow"`
+	Deny  []string `yaml:"deny" toml:"deny" json:"deny"`
+}
+
+// MimePolicies holds one policy per endpoint.
+type MimePolicies struct {
+	Upload  MimePolicy `yaml:"upload" toml:"upload" json:"upload"`
+	Archive MimePolicy `yaml:"archive" toml:"archive" json:"archive"`
+	Email   MimePolicy `yaml:"email" toml:"email" json:"email"`
+}
+
+const docxMimeType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+// DefaultMimePolicies returns the policies used when none are configured.
+func DefaultMimePolicies() MimePolicies {
+	return MimePolicies{
+		Upload: MimePolicy{Allow: []string{
+			"application/zip",
+			"application/x-tar",
+			"application/gzip",
+			"application/zstd",
+			"application/x-7z-compressed",
+			"application/x-rar-compressed",
+		}},
+		Archive: MimePolicy{Allow: []string{docxMimeType, "application/xml", "image/jpeg", "image/png"}},
+		Email:   MimePolicy{Allow: []string{docxMimeType, "application/pdf"}},
+	}
+}
+
+// Allows reports whether a type passes the policy. Several names of the
+// same type (aliases, parent types) may be given: the type is denied if any
+// name is denied and allowed if any name is allowed. Parameters such as
+// "; charset=utf-8" are ignored.
+func (p MimePolicy) Allows(names ...string) bool {
+	mtypes := make([]string, 0, len(names))
+	for _, name := range names {
+		if mtype := strings.ToLower(strings.TrimSpace(strings.Split(name, ";")[0])); mtype != "" {
+			mtypes = append(mtypes, mtype)
+		}
+	}
+	for _, pattern := range p.Deny {
+		for _, mtype := range mtypes {
+			if matchMimePattern(pattern, mtype) {
+				return false
+			}
+		}
+	}
+	for _, pattern := range p.Allow {
+		for _, mtype := range mtypes {
+			if matchMimePattern(pattern, mtype) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchMimePattern(pattern, mtype string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	switch {
+	case pattern == "*" || pattern == "*/*":
+		return true
+	case strings.HasSuffix(pattern, "/*"):
+		return strings.HasPrefix(mtype, strings.TrimSuffix(pattern, "*"))
+	default:
+		return pattern == mtype
+	}
+}
+
+// applyMimeEnv overrides policy lists from comma-separated env vars such as
+// ARCHIVE_MIME_ALLOW or EMAIL_MIME_DENY.
+func applyMimeEnv(policies *MimePolicies) {
+	for prefix, policy := range map[string]*MimePolicy{
+		"UPLOAD":  &policies.Upload,
+		"ARCHIVE": &policies.Archive,
+		"EMAIL":   &policies.Email,
+	} {
+		if list, ok := getEnvList(prefix + "_MIME_ALLOW"); ok {
+			policy.Allow = list
+		}
+		if list, ok := getEnvList(prefix + "_MIME_DENY"); ok {
+			policy.Deny = list
+		}
+	}
+}
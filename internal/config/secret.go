@@ -0,0 +1,274 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const redacted = "[REDACTED]"
+
+// Secret is a credential that can be reloaded while the server runs and
+// never shows up in logs or config dumps: String, text encodings and slog
+// all give "[REDACTED]". Copies share the value, so a reload reaches every
+// copy. The zero Secret is empty.
+type Secret struct {
+	value *atomic.Pointer[string]
+}
+
+func NewSecret(value string) Secret {
+	s := Secret{value: new(atomic.Pointer[string])}
+	s.value.Store(&value)
+	return s
+}
+
+// Value is the secret itself.
+func (s Secret) Value() string {
+	if s.value == nil {
+		return ""
+	}
+	if v := s.value.Load(); v != nil {
+		return *v
+	}
+	return ""
+}
+
+func (s Secret) String() string {
+	if s.Value() == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return "config.Secret(" + strconv.Quote(s.String()) + ")"
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText refuses secrets in config files: they come from env vars
+// or secret files only.
+func (s *Secret) UnmarshalText([]byte) error {
+	return errSecretInFile
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+var errSecretInFile = errors.New("secrets cannot be set in the config file, use NAME, NAME_FILE or NAME_ENCRYPTED_FILE env vars")
+
+// SecretProvider fetches the current value of one secret. It is asked on
+// Load and again on every ReloadSecrets.
+type SecretProvider interface {
+	Secret() (string, error)
+}
+
+// EnvSecret reads an env var.
+type EnvSecret struct {
+	Key string
+}
+
+func (p EnvSecret) Secret() (string, error) {
+	return os.Getenv(p.Key), nil
+}
+
+// FileSecret reads a file such as a Docker or Kubernetes secret mount.
+// A trailing newline is dropped.
+type FileSecret struct {
+	Path string
+}
+
+func (p FileSecret) Secret() (string, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// EncryptedFileSecret reads a file written by SealSecret and opens it with
+// Key, a base64-encoded AES-256 key.
+type EncryptedFileSecret struct {
+	Path string
+	Key  SecretProvider
+}
+
+func (p EncryptedFileSecret) Secret() (string, error) {
+	encoded, err := os.ReadFile(p.Path)
+	if err != nil {
+		return "", err
+	}
+	key, err := secretKey(p.Key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return "", fmt.Errorf("%s: not base64: %w", p.Path, err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("%s: too short", p.Path)
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("%s: cannot decrypt, wrong key or corrupted file", p.Path)
+	}
+	return string(plain), nil
+}
+
+// SealSecret encrypts value for EncryptedFileSecret with AES-256-GCM: the
+// result is base64 of the nonce followed by the ciphertext.
+func SealSecret(key []byte, value string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return []byte(base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("secrets key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func secretKey(p SecretProvider) ([]byte, error) {
+	if p == nil {
+		return nil, errors.New("no secrets key: set SECRETS_KEY or SECRETS_KEY_FILE")
+	}
+	encoded, err := p.Secret()
+	if err != nil {
+		return nil, err
+	}
+	if encoded == "" {
+		return nil, errors.New("no secrets key: set SECRETS_KEY or SECRETS_KEY_FILE")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("secrets key is not base64: %w", err)
+	}
+	return key, nil
+}
+
+// secretProvider picks where the secret name comes from: name_FILE, a file
+// mounted by Docker or Kubernetes; name_ENCRYPTED_FILE, a file sealed with
+// the key in SECRETS_KEY or SECRETS_KEY_FILE; or the name env var itself.
+// Only one of them may be set.
+func secretProvider(name string) (SecretProvider, error) {
+	var found []string
+	var provider SecretProvider = EnvSecret{Key: name}
+	if _, ok := os.LookupEnv(name); ok {
+		found = append(found, name)
+	}
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		found = append(found, name+"_FILE")
+		provider = FileSecret{Path: path}
+	}
+	if path := os.Getenv(name + "_ENCRYPTED_FILE"); path != "" {
+		found = append(found, name+"_ENCRYPTED_FILE")
+		key, err := keyProvider()
+		if err != nil {
+			return nil, err
+		}
+		provider = EncryptedFileSecret{Path: path, Key: key}
+	}
+	if len(found) > 1 {
+		return nil, fmt.Errorf("set only one of %s", strings.Join(found, ", "))
+	}
+	return provider, nil
+}
+
+// keyProvider is where the key of encrypted secret files comes from.
+func keyProvider() (SecretProvider, error) {
+	path := os.Getenv("SECRETS_KEY_FILE")
+	if _, ok := os.LookupEnv("SECRETS_KEY"); ok && path != "" {
+		return nil, errors.New("set only one of SECRETS_KEY, SECRETS_KEY_FILE")
+	}
+	if path != "" {
+		return FileSecret{Path: path}, nil
+	}
+	return EnvSecret{Key: "SECRETS_KEY"}, nil
+}
+
+// secretFields are the secrets of the config by env var name.
+func (c *Config) secretFields() map[string]*Secret {
+	return map[string]*Secret{
+		"PASSWORD":    &c.Password,
+		"ADMIN_TOKEN": &c.Admin.Token,
+	}
+}
+
+// loadSecrets reads every secret from its provider and remembers the
+// providers for ReloadSecrets.
+func (c *Config) loadSecrets() error {
+	c.providers = map[string]SecretProvider{}
+	for name, field := range c.secretFields() {
+		provider, err := secretProvider(name)
+		if err != nil {
+			return err
+		}
+		value, err := provider.Secret()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		c.providers[name] = provider
+		*field = NewSecret(value)
+	}
+	return nil
+}
+
+// ReloadSecrets reads every secret again, e.g. on SIGHUP after a secret
+// file was rotated. Nothing changes unless all of them can be read.
+func (c *Config) ReloadSecrets() error {
+	const op = "config.ReloadSecrets"
+	fields := c.secretFields()
+	values := make(map[string]string, len(c.providers))
+	for name, provider := range c.providers {
+		value, err := provider.Secret()
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", op, name, err)
+		}
+		values[name] = value
+	}
+	for name, value := range values {
+		fields[name].value.Store(&value)
+	}
+	return nil
+}
+
+// Redact replaces every secret value in s with "[REDACTED]". The logger
+// runs each line through it.
+func (c *Config) Redact(s string) string {
+	for _, field := range c.secretFields() {
+		if v := field.Value(); v != "" {
+			s = strings.ReplaceAll(s, v, redacted)
+		}
+	}
+	return s
+}
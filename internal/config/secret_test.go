@@ -0,0 +1,117 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSecretNeverPrints(t *testing.T) {
+	cfg := Config{Password: NewSecret("hunter2")}
+	for _, out := range []string{
+		cfg.Password.String(),
+		fmt.Sprintf("%v", cfg),
+		fmt.Sprintf("%+v", cfg),
+		fmt.Sprintf("%#v", cfg.Password),
+	} {
+		assert.NotContains(t, out, "hunter2")
+	}
+	data, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"password":"[REDACTED]"`)
+	data, err = yaml.Marshal(cfg)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "password: '[REDACTED]'")
+	assert.Equal(t, "hunter2", cfg.Password.Value())
+
+	// Копии видят перезагруженное значение.
+	copied := cfg.Password
+	cfg.Password.value.Store(new(string))
+	assert.Empty(t, copied.Value())
+	assert.Empty(t, Secret{}.Value())
+	assert.Empty(t, Secret{}.String(), "пустой секрет не помечается")
+}
+
+func TestSecretProviders(t *testing.T) {
+	dir := t.TempDir()
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	sealed, err := SealSecret(key, "from-encrypted")
+	require.NoError(t, err)
+	encPath := filepath.Join(dir, "password.enc")
+	require.NoError(t, os.WriteFile(encPath, sealed, 0o600))
+	filePath := filepath.Join(dir, "password")
+	require.NoError(t, os.WriteFile(filePath, []byte("from-file\n"), 0o600))
+	t.Setenv("SECRETS_KEY", base64.StdEncoding.EncodeToString(key))
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"Из переменной окружения", map[string]string{"PASSWORD": "from-env"}, "from-env"},
+		{"Из файла", map[string]string{"PASSWORD_FILE": filePath}, "from-file"},
+		{"Из зашифрованного файла", map[string]string{"PASSWORD_ENCRYPTED_FILE": encPath}, "from-encrypted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := Load(nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg.Password.Value())
+		})
+	}
+
+	t.Run("Неверный ключ", func(t *testing.T) {
+		t.Setenv("PASSWORD_ENCRYPTED_FILE", encPath)
+		t.Setenv("SECRETS_KEY", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+		_, err := Load(nil)
+		assert.ErrorContains(t, err, "cannot decrypt")
+	})
+	t.Run("Несколько источников сразу", func(t *testing.T) {
+		t.Setenv("PASSWORD", "from-env")
+		t.Setenv("PASSWORD_FILE", filePath)
+		_, err := Load(nil)
+		assert.ErrorContains(t, err, "set only one of PASSWORD, PASSWORD_FILE")
+	})
+	t.Run("Секрет в файле конфигурации", func(t *testing.T) {
+		path := filepath.Join(dir, "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("password: hunter2\n"), 0o600))
+		t.Setenv("CONFIG_PATH", path)
+		_, err := Load(nil)
+		assert.ErrorIs(t, err, errSecretInFile)
+	})
+}
+
+func TestReloadSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("old"), 0o600))
+	t.Setenv("ADMIN_TOKEN_FILE", path)
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	token := cfg.Admin.Token
+	assert.Equal(t, "old", token.Value())
+	assert.Equal(t, "[REDACTED] and [REDACTED]", cfg.Redact("old and old"))
+
+	require.NoError(t, os.WriteFile(path, []byte("new"), 0o600))
+	require.NoError(t, cfg.ReloadSecrets())
+	assert.Equal(t, "new", token.Value(), "копия видит новое значение")
+	assert.Equal(t, "old [REDACTED]", cfg.Redact("old new"))
+
+	// Неудачная перезагрузка оставляет прежние значения.
+	require.NoError(t, os.Remove(path))
+	assert.Error(t, cfg.ReloadSecrets())
+	assert.Equal(t, "new", cfg.Admin.Token.Value())
+}
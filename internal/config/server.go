@@ -0,0 +1,153 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Server configures the HTTP listener. The timeouts are those of
+// http.Server; Routes lengthens or shortens them for single routes.
+// ShutdownTimeout bounds how long requests in flight and the email queue
+// get to finish on shutdown.
+type Server struct {
+	Addr              string                   `env:"HTTP_ADDR" yaml:"addr" toml:"addr" json:"addr"`
+	ReadTimeout       time.Duration            `env:"HTTP_READ_TIMEOUT" yaml:"read_timeout" toml:"read_timeout" json:"read_timeout"`
+	ReadHeaderTimeout time.Duration            `env:"HTTP_READ_HEADER_TIMEOUT" yaml:"read_header_timeout" toml:"read_header_timeout" json:"read_header_timeout"`
+	WriteTimeout      time.Duration            `env:"HTTP_WRITE_TIMEOUT" yaml:"write_timeout" toml:"write_timeout" json:"write_timeout"`
+	IdleTimeout       time.Duration            `env:"HTTP_IDLE_TIMEOUT" yaml:"idle_timeout" toml:"idle_timeout" json:"idle_timeout"`
+	MaxHeaderBytes    int                      `env:"HTTP_MAX_HEADER_BYTES" yaml:"max_header_bytes" toml:"max_header_bytes" json:"max_header_bytes"`
+	ShutdownTimeout   time.Duration            `env:"HTTP_SHUTDOWN_TIMEOUT" yaml:"shutdown_timeout" toml:"shutdown_timeout" json:"shutdown_timeout"`
+	Routes            map[string]RouteTimeouts `yaml:"routes" toml:"routes" json:"routes"`
+	TLS               TLS                      `yaml:"tls" toml:"tls" json:"tls"`
+}
+
+// TLS serves HTTPS on Addr when CertFile and KeyFile are set. The files are
+// read again when they change, so a renewed certificate needs no restart.
+// With ClientCAFile every client must present a certificate signed by one
+// of the CAs in that PEM bundle. RedirectAddr, when set, is a plain HTTP
+// listener that redirects every request to HTTPS.
+type TLS struct {
+	CertFile     string `env:"TLS_CERT_FILE" yaml:"cert_file" toml:"cert_file" json:"cert_file"`
+	KeyFile      string `env:"TLS_KEY_FILE" yaml:"key_file" toml:"key_file" json:"key_file"`
+	ClientCAFile string `env:"TLS_CLIENT_CA_FILE" yaml:"client_ca_file" toml:"client_ca_file" json:"client_ca_file"`
+	RedirectAddr string `env:"TLS_REDIRECT_ADDR" yaml:"redirect_addr" toml:"redirect_addr" json:"redirect_addr"`
+}
+
+// Enabled reports whether the server speaks HTTPS.
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+func (t TLS) validate() error {
+	if t.CertFile == "" && t.KeyFile != "" || t.CertFile != "" && t.KeyFile == "" {
+		return fmt.Errorf("server.tls: cert_file and key_file must be set together")
+	}
+	if !t.Enabled() && (t.ClientCAFile != "" || t.RedirectAddr != "") {
+		return fmt.Errorf("server.tls: client_ca_file and redirect_addr need cert_file and key_file")
+	}
+	return nil
+}
+
+// RouteTimeouts override the server timeouts for one route, keyed by its
+// path such as /api/v1/archive/files; the legacy alias of the route gets
+// them too. They count from when the handler starts, and zero keeps the
+// server value, except that a longer ReadTimeout pushes the write deadline
+// out with it: the server WriteTimeout then starts after the read window.
+// On streaming routes every chunk sent pushes the write
+// deadline ChunkWriteTimeout ahead, so a long download fails only when it
+// stalls.
+type RouteTimeouts struct {
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout" json:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout" json:"write_timeout"`
+	ChunkWriteTimeout time.Duration `yaml:"chunk_write_timeout" toml:"chunk_write_timeout" json:"chunk_write_timeout"`
+}
+
+// DefaultServer listens on :8080. Uploads get longer to arrive than other
+// requests, and the archive stream may run as long as it keeps moving.
+func DefaultServer() Server {
+	return Server{
+		Addr:              ":8080",
+		ReadTimeout:       time.Minute,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      time.Minute,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+		ShutdownTimeout:   3 * time.Minute,
+		Routes: map[string]RouteTimeouts{
+			"/api/v1/archive/information": {ReadTimeout: 10 * time.Minute},
+			"/api/v1/archive/files":       {ReadTimeout: 10 * time.Minute, ChunkWriteTimeout: 30 * time.Second},
+			"/api/v1/mail/file":           {ReadTimeout: 5 * time.Minute},
+			"/api/v1/mail/archive":        {ReadTimeout: 5 * time.Minute},
+		},
+	}
+}
+
+func applyServerEnv(s *Server) error {
+	if addr := os.Getenv("HTTP_ADDR"); addr != "" {
+		s.Addr = addr
+	}
+	for key, d := range map[string]*time.Duration{
+		"HTTP_READ_TIMEOUT":        &s.ReadTimeout,
+		"HTTP_READ_HEADER_TIMEOUT": &s.ReadHeaderTimeout,
+		"HTTP_WRITE_TIMEOUT":       &s.WriteTimeout,
+		"HTTP_IDLE_TIMEOUT":        &s.IdleTimeout,
+		"HTTP_SHUTDOWN_TIMEOUT":    &s.ShutdownTimeout,
+	} {
+		var err error
+		if *d, err = getEnvDuration(key, *d); err != nil {
+			return err
+		}
+	}
+	if value := os.Getenv("HTTP_MAX_HEADER_BYTES"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("HTTP_MAX_HEADER_BYTES must be a number, got %q", value)
+		}
+		s.MaxHeaderBytes = n
+	}
+	for key, value := range map[string]*string{
+		"TLS_CERT_FILE":      &s.TLS.CertFile,
+		"TLS_KEY_FILE":       &s.TLS.KeyFile,
+		"TLS_CLIENT_CA_FILE": &s.TLS.ClientCAFile,
+		"TLS_REDIRECT_ADDR":  &s.TLS.RedirectAddr,
+	} {
+		if v := os.Getenv(key); v != "" {
+			*value = v
+		}
+	}
+	return nil
+}
+
+func (s Server) validate() error {
+	if s.Addr == "" {
+		return fmt.Errorf("server.addr is required")
+	}
+	durations := map[string]time.Duration{
+		"server.read_timeout":        s.ReadTimeout,
+		"server.read_header_timeout": s.ReadHeaderTimeout,
+		"server.write_timeout":       s.WriteTimeout,
+		"server.idle_timeout":        s.IdleTimeout,
+		"server.shutdown_timeout":    s.ShutdownTimeout,
+	}
+	for path, route := range s.Routes {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("server.routes: %q is not a path", path)
+		}
+		durations["server.routes."+path+".read_timeout"] = route.ReadTimeout
+		durations["server.routes."+path+".write_timeout"] = route.WriteTimeout
+		durations["server.routes."+path+".chunk_write_timeout"] = route.ChunkWriteTimeout
+	}
+	for key, d := range durations {
+		if d < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", key, d)
+		}
+	}
+	if s.MaxHeaderBytes <= 0 {
+		return fmt.Errorf("server.max_header_bytes must be positive, got %d", s.MaxHeaderBytes)
+	}
+	return s.TLS.validate()
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TLS modes for the SMTP connection.
+const (
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSImplicit = "tls"
+	SMTPTLSNone     = "none"
+)
+
+// Authentication mechanisms for the SMTP relay.
+const (
+	SMTPAuthPlain   = "plain"
+	SMTPAuthLogin   = "login"
+	SMTPAuthCRAMMD5 = "cram-md5"
+	SMTPAuthNone    = "none"
+)
+
+// SMTP describes the relay used by /sendemailandfile. Username defaults to
+// the top-level Email and goes with the top-level Password, a secret.
+type SMTP struct {
+	Host     string `env:"SMTP_HOST" yaml:"host" toml:"host" json:"host"`
+	Port     int    `env:"SMTP_PORT" yaml:"port" toml:"port" json:"port"`
+	TLSMode  string `env:"SMTP_TLS" yaml:"tls" toml:"tls" json:"tls"`
+	Auth     string `env:"SMTP_AUTH" yaml:"auth" toml:"auth" json:"auth"`
+	From     string `env:"SMTP_FROM" yaml:"from" toml:"from" json:"from"`
+	Username string `env:"SMTP_USERNAME" yaml:"username" toml:"username" json:"username"`
+}
+
+// DefaultSMTP returns the Gmail submission settings the service started with.
+func DefaultSMTP() SMTP {
+	return SMTP{
+		Host:    "smtp.gmail.com",
+		Port:    587,
+		TLSMode: SMTPTLSStartTLS,
+		Auth:    SMTPAuthPlain,
+	}
+}
+
+// Addr is the host:port pair to dial.
+func (s SMTP) Addr() string {
+	return s.Host + ":" + strconv.Itoa(s.Port)
+}
+
+// applySMTPEnv overrides SMTP settings from SMTP_* env vars.
+func applySMTPEnv(s *SMTP) error {
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		s.Host = host
+	}
+	if port := os.Getenv("SMTP_PORT"); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("SMTP_PORT must be a port number, got %q", port)
+		}
+		s.Port = n
+	}
+	if mode := os.Getenv("SMTP_TLS"); mode != "" {
+		s.TLSMode = mode
+	}
+	if auth := os.Getenv("SMTP_AUTH"); auth != "" {
+		s.Auth = auth
+	}
+	if from := os.Getenv("SMTP_FROM"); from != "" {
+		s.From = from
+	}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		s.Username = username
+	}
+	return nil
+}
+
+// validate checks the relay settings and lower-cases the TLS mode and auth.
+func (s *SMTP) validate() error {
+	if s.Port <= 0 || s.Port > 65535 {
+		return fmt.Errorf("smtp.port must be a port number, got %d", s.Port)
+	}
+	s.TLSMode = strings.ToLower(s.TLSMode)
+	s.Auth = strings.ToLower(s.Auth)
+	switch s.TLSMode {
+	case SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+	default:
+		return fmt.Errorf("smtp.tls must be starttls, tls or none, got %q", s.TLSMode)
+	}
+	switch s.Auth {
+	case SMTPAuthPlain, SMTPAuthLogin, SMTPAuthCRAMMD5, SMTPAuthNone:
+	default:
+		return fmt.Errorf("smtp.auth must be plain, login, cram-md5 or none, got %q", s.Auth)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package delivery
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// adminOnly requires "Authorization: Bearer <ADMIN_TOKEN>". Without a
+// configured token the admin endpoints are disabled.
+func (h *Handler) adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		want := h.cfg.Admin.Token.Value()
+		if want == "" {
+			h.writeError(w, errAdminDisabled)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			h.writeError(w, errUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// dead_letters lists deliveries that failed for good.
+func (h *Handler) dead_letters(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.dead_letters"
+	log := h.log.With(
+		slog.String("op", op),
+	)
+	letters, err := h.services.DeadLetters()
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	h.EncodeJSON(w, http.StatusOK, letters)
+}
+
+// replay_dead_letter queues a dead letter again as a new job.
+func (h *Handler) replay_dead_letter(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.replay_dead_letter"
+	log := h.log.With(
+		slog.String("op", op),
+	)
+	job, err := h.services.ReplayDeadLetter(r.PathValue("id"))
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", jobLocation(job.ID))
+	h.EncodeJSON(w, http.StatusAccepted, job)
+}
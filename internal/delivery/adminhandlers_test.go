@@ -0,0 +1,47 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"doodocsbackendchallenge/internal/config"
+	"doodocsbackendchallenge/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminDeadLetters(t *testing.T) {
+	cfg := &config.Config{Limits: config.DefaultLimits()}
+	h := newTestHandler(t, cfg)
+
+	do := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.Handlers().ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/admin/deadletters", "").Code, "disabled without a token")
+
+	cfg.Admin.Token = config.NewSecret("s3cret")
+	rec := do(http.MethodGet, "/admin/deadletters", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/admin/deadletters", "wrong").Code)
+
+	rec = do(http.MethodGet, "/admin/deadletters", "s3cret")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp struct {
+		Data []models.DeadLetter
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Empty(t, resp.Data)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/admin/deadletters/missing/replay", "s3cret").Code)
+}
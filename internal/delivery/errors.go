@@ -0,0 +1,154 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"doodocsbackendchallenge/internal/service"
+)
+
+// Error codes are part of the API: clients match on them, while messages
+// may change.
+const (
+	codeMalformedRequest   = "malformed_request"
+	codeMissingFile        = "missing_file"
+	codeInvalidVariables   = "invalid_variables"
+	codeInvalidDryRun      = "invalid_dry_run"
+	codeUnsupportedFormat  = "unsupported_format"
+	codeMalformedArchive   = "malformed_archive"
+	codePartTooLarge       = "part_too_large"
+	codeRequestTooLarge    = "request_too_large"
+	codeArchiveTooLarge    = "archive_too_large"
+	codeMimeMismatch       = "mime_mismatch"
+	codeMimeNotAllowed     = "mime_not_allowed"
+	codeUnsupportedArchive = "unsupported_archive"
+	codeUnsafePath         = "unsafe_path"
+	codeInvalidAddress     = "invalid_address"
+	codeInvalidTemplate    = "invalid_template"
+	codeNotFound           = "not_found"
+	codeEmailDisabled      = "email_disabled"
+	codeUnauthorized       = "unauthorized"
+	codeForbidden          = "forbidden"
+	codeMethodNotAllowed   = "method_not_allowed"
+	codeInternal           = "internal_error"
+)
+
+// apiError is an error with its response decided: the status and the
+// machine-readable error {code, message, details}.
+type apiError struct {
+	status  int
+	Code    string
+	Message string
+	Details any
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+var (
+	errMalformedForm    = errors.New("malformed multipart form")
+	errInvalidVariables = errors.New("variables must be a JSON object")
+	errInvalidDryRun    = errors.New("dry_run must be true or false")
+
+	errMethodNotAllowed = &apiError{status: http.StatusMethodNotAllowed, Code: codeMethodNotAllowed, Message: "method not allowed"}
+	errAdminDisabled    = &apiError{status: http.StatusForbidden, Code: codeForbidden, Message: "admin API is disabled"}
+	errUnauthorized     = &apiError{status: http.StatusUnauthorized, Code: codeUnauthorized, Message: "missing or invalid bearer token"}
+)
+
+type limitDetails struct {
+	Part  string `json:"part,omitempty"`
+	Limit int64  `json:"limit"`
+}
+
+type mimeDetails struct {
+	Filename string `json:"filename"`
+	Claimed  string `json:"claimed,omitempty"`
+	Detected string `json:"detected"`
+}
+
+type addressDetails struct {
+	Field string `json:"field"`
+	Input string `json:"input,omitempty"`
+}
+
+// toAPIError maps service and transport errors to responses. Only the
+// typed error is shown to the client, never the wrapping chain; anything
+// unknown is a 500 with a generic message.
+func toAPIError(err error) *apiError {
+	var (
+		api        *apiError
+		part       *PartTooLargeError
+		maxBytes   *http.MaxBytesError
+		archiveBig *service.ArchiveTooLargeError
+		mismatch   *service.MimeMismatchError
+		notAllowed *service.MimeNotAllowedError
+		unsafe     *service.UnsafePathError
+		malformed  *service.MalformedArchiveError
+		format     *service.UnsupportedFormatError
+		address    *service.AddressError
+		tmpl       *service.TemplateError
+	)
+	switch {
+	case errors.As(err, &api):
+		return api
+	// Size limits first: an upload cut short by a limit also fails to parse.
+	case errors.As(err, &part):
+		return &apiError{http.StatusRequestEntityTooLarge, codePartTooLarge, part.Error(), limitDetails{Part: part.Part, Limit: part.Limit}}
+	case errors.As(err, &maxBytes):
+		return &apiError{http.StatusRequestEntityTooLarge, codeRequestTooLarge, "request body too large", limitDetails{Limit: maxBytes.Limit}}
+	case errors.As(err, &archiveBig):
+		return &apiError{http.StatusRequestEntityTooLarge, codeArchiveTooLarge, archiveBig.Error(), limitDetails{Limit: archiveBig.Limit}}
+	case errors.As(err, &mismatch):
+		return &apiError{http.StatusUnsupportedMediaType, codeMimeMismatch, mismatch.Error(), mimeDetails{mismatch.Filename, mismatch.Claimed, mismatch.Detected}}
+	case errors.As(err, &notAllowed):
+		return &apiError{http.StatusUnsupportedMediaType, codeMimeNotAllowed, notAllowed.Error(), mimeDetails{Filename: notAllowed.Filename, Detected: notAllowed.Detected}}
+	case errors.Is(err, service.ErrUnsupportedArchive):
+		return &apiError{http.StatusUnsupportedMediaType, codeUnsupportedArchive, service.ErrUnsupportedArchive.Error(), nil}
+	case errors.As(err, &unsafe):
+		return &apiError{http.StatusUnprocessableEntity, codeUnsafePath, unsafe.Error(), map[string]string{"name": unsafe.Name}}
+	case errors.As(err, &malformed):
+		return &apiError{http.StatusBadRequest, codeMalformedArchive, malformed.Error(), map[string]string{"format": malformed.Format}}
+	case errors.As(err, &format):
+		return &apiError{http.StatusBadRequest, codeUnsupportedFormat, format.Error(), map[string]string{"format": format.Format}}
+	case errors.Is(err, http.ErrMissingFile):
+		return &apiError{http.StatusBadRequest, codeMissingFile, http.ErrMissingFile.Error(), nil}
+	case errors.Is(err, errMalformedForm):
+		return &apiError{http.StatusBadRequest, codeMalformedRequest, errMalformedForm.Error(), nil}
+	case errors.Is(err, http.ErrNotMultipart), errors.Is(err, http.ErrMissingBoundary):
+		return &apiError{http.StatusBadRequest, codeMalformedRequest, err.Error(), nil}
+	case errors.Is(err, errInvalidVariables):
+		return &apiError{http.StatusBadRequest, codeInvalidVariables, err.Error(), nil}
+	case errors.Is(err, errInvalidDryRun):
+		return &apiError{http.StatusBadRequest, codeInvalidDryRun, err.Error(), nil}
+	case errors.As(err, &address):
+		return &apiError{http.StatusUnprocessableEntity, codeInvalidAddress, address.Error(), addressDetails{address.Field, address.Input}}
+	case errors.As(err, &tmpl):
+		return &apiError{http.StatusUnprocessableEntity, codeInvalidTemplate, tmpl.Error(), map[string]string{"template": tmpl.Name}}
+	case errors.Is(err, service.ErrJobNotFound):
+		return &apiError{http.StatusNotFound, codeNotFound, service.ErrJobNotFound.Error(), nil}
+	case errors.Is(err, service.ErrDeadLetterNotFound):
+		return &apiError{http.StatusNotFound, codeNotFound, service.ErrDeadLetterNotFound.Error(), nil}
+	case errors.Is(err, service.ErrEmailDisabled):
+		return &apiError{http.StatusServiceUnavailable, codeEmailDisabled, service.ErrEmailDisabled.Error(), nil}
+	}
+	return &apiError{http.StatusInternalServerError, codeInternal, "internal server error", nil}
+}
+
+// writeError answers with the status and body err maps to.
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	api := toAPIError(err)
+	h.writeResponse(w, Response{
+		Version: ResponseVersion,
+		Status:  api.status,
+		Error:   &ResponseError{Code: api.Code, Message: api.Message, Details: api.Details},
+	})
+}
+
+// trailerValue makes an error safe to send as a header value once the
+// response has started: its code and message on one line.
+func trailerValue(err error) string {
+	api := toAPIError(err)
+	return api.Code + ": " + strings.Join(strings.Fields(api.Message), " ")
+}
@@ -0,0 +1,105 @@
+package delivery
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"doodocsbackendchallenge/internal/config"
+	"doodocsbackendchallenge/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToAPIError(t *testing.T) {
+	// Ошибки приходят из сервиса обернутыми, с op и переводом строки.
+	wrap := func(err error) error {
+		return fmt.Errorf("%s: %w\n", "service.Op", err)
+	}
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"Превышен лимит части", wrap(&PartTooLargeError{Part: "a.zip", Limit: 1}), http.StatusRequestEntityTooLarge, codePartTooLarge},
+		{"Превышен лимит запроса", wrap(&http.MaxBytesError{Limit: 1}), http.StatusRequestEntityTooLarge, codeRequestTooLarge},
+		{"Лимит важнее поломки формы", fmt.Errorf("%w: %w", errMalformedForm, &http.MaxBytesError{Limit: 1}), http.StatusRequestEntityTooLarge, codeRequestTooLarge},
+		{"Слишком большой архив", wrap(&service.ArchiveTooLargeError{Limit: 1}), http.StatusRequestEntityTooLarge, codeArchiveTooLarge},
+		{"Содержимое не совпадает с расширением", wrap(&service.MimeMismatchError{Filename: "a.png"}), http.StatusUnsupportedMediaType, codeMimeMismatch},
+		{"Тип запрещен политикой", wrap(&service.MimeNotAllowedError{Filename: "a.txt", Detected: "text/plain"}), http.StatusUnsupportedMediaType, codeMimeNotAllowed},
+		{"Не архив", wrap(service.ErrUnsupportedArchive), http.StatusUnsupportedMediaType, codeUnsupportedArchive},
+		{"Путь выходит из архива", wrap(&service.UnsafePathError{Name: "../a"}), http.StatusUnprocessableEntity, codeUnsafePath},
+		{"Битый zip", wrap(&service.MalformedArchiveError{Format: "zip", Err: errors.New("zip: not a valid zip file")}), http.StatusBadRequest, codeMalformedArchive},
+		{"Неизвестный формат", &service.UnsupportedFormatError{Format: "rar"}, http.StatusBadRequest, codeUnsupportedFormat},
+		{"Нет файла", http.ErrMissingFile, http.StatusBadRequest, codeMissingFile},
+		{"Форма оборвалась", wrap(fmt.Errorf("%w: %w", errMalformedForm, io.ErrUnexpectedEOF)), http.StatusBadRequest, codeMalformedRequest},
+		{"Не multipart", http.ErrNotMultipart, http.StatusBadRequest, codeMalformedRequest},
+		{"Некорректные variables", fmt.Errorf("%w: %v", errInvalidVariables, "EOF"), http.StatusBadRequest, codeInvalidVariables},
+		{"Некорректный адрес", wrap(&service.AddressError{Field: "emails", Input: "nope", Err: errors.New("no angle-addr")}), http.StatusUnprocessableEntity, codeInvalidAddress},
+		{"Ошибка шаблона", wrap(&service.TemplateError{Name: "x", Err: service.ErrUnknownTemplate}), http.StatusUnprocessableEntity, codeInvalidTemplate},
+		{"Нет задачи", wrap(service.ErrJobNotFound), http.StatusNotFound, codeNotFound},
+		{"Нет письма", wrap(service.ErrDeadLetterNotFound), http.StatusNotFound, codeNotFound},
+		{"Почта выключена", wrap(service.ErrEmailDisabled), http.StatusServiceUnavailable, codeEmailDisabled},
+		{"Неизвестная ошибка", wrap(errors.New("disk on fire")), http.StatusInternalServerError, codeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toAPIError(tt.err)
+			assert.Equal(t, tt.status, got.status)
+			assert.Equal(t, tt.code, got.Code)
+			assert.NotContains(t, got.Message, "service.Op")
+			assert.False(t, strings.HasSuffix(got.Message, "\n"))
+		})
+	}
+	assert.Equal(t, "internal server error", toAPIError(errors.New("disk on fire")).Message, "внутренние детали не уходят клиенту")
+	assert.Equal(t, "malformed multipart form", toAPIError(wrap(fmt.Errorf("%w: %w", errMalformedForm, io.ErrUnexpectedEOF))).Message)
+}
+
+func TestErrorStatuses(t *testing.T) {
+	zipData, err := os.ReadFile("../service/testdata/test.zip")
+	require.NoError(t, err)
+	h := newTestHandler(t, &config.Config{Limits: config.DefaultLimits(), Mime: config.DefaultMimePolicies()})
+
+	tests := []struct {
+		name     string
+		path     string
+		field    string
+		filename string
+		content  []byte
+		status   int
+		code     string
+	}{
+		{"Битый zip", "/uploadfilearchive", "myFile", "test.zip", zipData[:len(zipData)/2], http.StatusBadRequest, codeMalformedArchive},
+		{"Не архив", "/uploadfilearchive", "myFile", "notes", []byte("plain text"), http.StatusUnsupportedMediaType, codeUnsupportedArchive},
+		{"Запрещенный тип в архив", "/archivefiles", "filestoarchive", "notes.txt", []byte("plain text"), http.StatusUnsupportedMediaType, codeMimeNotAllowed},
+		{"Нет файла", "/uploadfilearchive", "other", "test.zip", zipData, http.StatusBadRequest, codeMissingFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := multipartBody(t, tt.field, tt.filename, tt.content)
+			req := httptest.NewRequest(http.MethodPost, tt.path, body)
+			req.Header.Set("Content-Type", contentType)
+			rec := httptest.NewRecorder()
+			h.Handlers().ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.Contains(t, rec.Body.String(), `"code":"`+tt.code+`"`)
+		})
+	}
+
+	t.Run("Тело не multipart", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/archivefiles", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.Handlers().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"code":"`+codeMalformedRequest+`"`)
+	})
+}
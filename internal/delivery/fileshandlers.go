@@ -1,9 +1,15 @@
 package delivery
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
-	"strings"
+	"strconv"
+
+	"doodocsbackendchallenge/internal/service"
 )
 
 func (h *Handler) uploadfile_inarchive(w http.ResponseWriter, r *http.Request) {
@@ -11,88 +17,274 @@ func (h *Handler) uploadfile_inarchive(w http.ResponseWriter, r *http.Request) {
 	log := h.log.With(
 		slog.String("op", op),
 	)
-	switch r.Method {
-	case "POST":
-		err := r.ParseMultipartForm(10 << 20)
-		if err != nil {
-			log.Error(err.Error())
-			h.EncodeJSON(w, r, http.StatusInternalServerError, err.Error(), nil)
+	uploads, err := newMultipartUploads(w, r, "myFile", h.cfg.Limits)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	file, err := nextUpload(uploads)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	archive, err := h.services.UploadFileGetJSON(file)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	h.EncodeJSON(w, http.StatusOK, archive)
+	log.Debug("archive", slog.Any("archive", archive))
+}
+
+func (h *Handler) archive_files(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.archive_files"
+	log := h.log.With(
+		slog.String("op", op),
+	)
+	uploads, err := newMultipartUploads(w, r, "filestoarchive", h.cfg.Limits)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	// The format has to be known before the first file is streamed, so it
+	// is taken from the query string or a field sent ahead of the files.
+	if err := uploads.Peek(); err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	format, err := service.LookupArchiveFormat(uploads.Value("format"))
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+format.Filename())
+	w.Header().Set("Trailer", archiveErrorTrailer)
+	stream := newStreamWriter(w, routeTimeouts(r).ChunkWriteTimeout)
+	err = h.services.ArchiveInFiles(stream, uploads, format)
+	if err != nil {
+		log.Error(err.Error())
+		if !stream.started() {
+			w.Header().Del("Content-Disposition")
+			w.Header().Del("Trailer")
+			h.writeError(w, err)
 			return
 		}
-		file, fileheader, err := r.FormFile("myFile")
+		w.Header().Set(archiveErrorTrailer, trailerValue(err))
+	}
+}
+
+func (h *Handler) sendemails_file(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.sendemails_file"
+	log := h.log.With(
+		slog.String("op", op),
+	)
+	uploads, err := newMultipartUploads(w, r, "fileToGetEmail", h.cfg.Limits)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	// The attachments go to every recipient, so they are kept in memory
+	// while the rest of the form, including "emails", is read.
+	files, err := readUploads(uploads)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	var archive *service.ArchiveFormat
+	if name := uploads.Value("archive"); name != "" {
+		format, err := service.LookupArchiveFormat(name)
 		if err != nil {
 			log.Error(err.Error())
-			h.EncodeJSON(w, r, http.StatusInternalServerError, err.Error(), nil)
+			h.writeError(w, err)
 			return
 		}
-		defer file.Close()
-		archive, err := h.services.UploadFileGetJSON(file, fileheader)
+		archive = &format
+	}
+	recipients, err := service.ParseRecipients(
+		uploads.Value("emails"),
+		uploads.Value("cc"),
+		uploads.Value("bcc"),
+		uploads.Value("reply_to"),
+	)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	log.Info("emails", slog.Int("to", len(recipients.To)), slog.Int("cc", len(recipients.Cc)), slog.Int("bcc", len(recipients.Bcc)))
+	message, err := emailContent(uploads)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	dryRun, err := dryRun(uploads)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	if dryRun {
+		preview, err := h.services.PreviewEmail(recipients, message, service.MemoryUploads(files...), archive)
 		if err != nil {
 			log.Error(err.Error())
-			h.EncodeJSON(w, r, http.StatusInternalServerError, err.Error(), nil)
+			h.writeError(w, err)
 			return
 		}
-		h.EncodeJSON(w, r, http.StatusOK, "", archive)
-		log.Debug("archive", archive)
-	default:
-		h.EncodeJSON(w, r, http.StatusMethodNotAllowed, "", nil)
+		h.EncodeJSON(w, http.StatusOK, preview)
+		return
+	}
+	job, err := h.services.EnqueueEmail(recipients, message, service.MemoryUploads(files...), archive)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
 	}
+	w.Header().Set("Location", jobLocation(job.ID))
+	h.EncodeJSON(w, http.StatusAccepted, job)
 }
 
-func (h *Handler) archive_files(w http.ResponseWriter, r *http.Request) {
-	const op = "delivery.archive_files"
+// archive_send_email archives the "filestoarchive" files like /archivefiles
+// and mails the archive like /sendemailandfile, under the ArchiveEmail limits.
+func (h *Handler) archive_send_email(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.archive_send_email"
 	log := h.log.With(
 		slog.String("op", op),
 	)
-	switch r.Method {
-	case "POST":
-		err := r.ParseMultipartForm(10 << 20)
-		if err != nil {
-			log.Error(err.Error())
-			h.EncodeJSON(w, r, http.StatusInternalServerError, err.Error(), nil)
-			return
-		}
-		files := r.MultipartForm.File["filestoarchive"]
-		buf, err := h.services.ArchiveInFiles(files)
+	uploads, err := newMultipartUploads(w, r, "filestoarchive", h.cfg.ArchiveEmail.Limits())
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	files, err := readUploads(uploads)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	format, err := service.LookupArchiveFormat(uploads.Value("format"))
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	recipients, err := service.ParseRecipients(
+		uploads.Value("emails"),
+		uploads.Value("cc"),
+		uploads.Value("bcc"),
+		uploads.Value("reply_to"),
+	)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	message, err := emailContent(uploads)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	dryRun, err := dryRun(uploads)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	if dryRun {
+		preview, err := h.services.PreviewArchiveEmail(recipients, message, service.MemoryUploads(files...), format)
 		if err != nil {
 			log.Error(err.Error())
-			h.EncodeJSON(w, r, http.StatusInternalServerError, err.Error(), nil)
+			h.writeError(w, err)
 			return
 		}
+		h.EncodeJSON(w, http.StatusOK, preview)
+		return
+	}
+	job, err := h.services.EnqueueArchiveEmail(recipients, message, service.MemoryUploads(files...), format)
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", jobLocation(job.ID))
+	h.EncodeJSON(w, http.StatusAccepted, job)
+}
+
+// dryRun reads the dry_run field: when true, the request is checked and the
+// message rendered, but nothing is queued or sent.
+func dryRun(uploads *multipartUploads) (bool, error) {
+	value := uploads.Value("dry_run")
+	if value == "" {
+		return false, nil
+	}
+	dry, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%w: %q", errInvalidDryRun, value)
+	}
+	return dry, nil
+}
 
-		w.Header().Set("Content-Type", "application/zip")
-		w.Header().Set("Content-Diposition", "attachment; filename=archive.zip")
-		w.Write(buf.Bytes())
-		h.EncodeJSON(w, r, http.StatusOK, "", nil)
+// emailContent reads subject, body, html_body, template and variables, a
+// JSON object passed to the template.
+func emailContent(uploads *multipartUploads) (service.EmailContent, error) {
+	content := service.EmailContent{
+		Subject:  uploads.Value("subject"),
+		Text:     uploads.Value("body"),
+		HTML:     uploads.Value("html_body"),
+		Template: uploads.Value("template"),
+	}
+	if vars := uploads.Value("variables"); vars != "" {
+		if err := json.Unmarshal([]byte(vars), &content.Variables); err != nil {
+			return service.EmailContent{}, fmt.Errorf("%w: %v", errInvalidVariables, err)
+		}
+	}
+	return content, nil
+}
 
-	default:
-		h.EncodeJSON(w, r, http.StatusMethodNotAllowed, "", nil)
+// nextUpload returns the first file of the form, or http.ErrMissingFile.
+func nextUpload(uploads *multipartUploads) (*service.Upload, error) {
+	file, err := uploads.Next()
+	if err == io.EOF {
+		return nil, http.ErrMissingFile
 	}
+	return file, err
 }
 
-func (h *Handler) sendemails_file(w http.ResponseWriter, r *http.Request) {
-	const op = "delivery.sendemails_file"
-	log := h.log.With(
-		slog.String("op", op),
-	)
-	switch r.Method {
-	case "POST":
-		file, fileHeader, err := r.FormFile("fileToGetEmail")
+// readUploads reads every file of the form into memory, along with the
+// fields that follow them. It returns http.ErrMissingFile when there is none.
+func readUploads(uploads *multipartUploads) ([]*service.Upload, error) {
+	var files []*service.Upload
+	for {
+		file, err := uploads.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			log.Error(err.Error())
-			h.EncodeJSON(w, r, http.StatusInternalServerError, err.Error(), nil)
-			return
+			return nil, err
 		}
-		defer file.Close()
-		emails := strings.Split(r.FormValue("emails"), ", ")
-		log.Info("emails:", emails)
-		if err := h.services.GetEmailAndFileSendEmail(emails, file, fileHeader.Filename); err != nil {
-			log.Error(err.Error())
-			h.EncodeJSON(w, r, http.StatusInternalServerError, err.Error(), nil)
-			return
+		content, err := io.ReadAll(file.Body)
+		if err != nil {
+			return nil, err
 		}
-		h.EncodeJSON(w, r, http.StatusOK, "", nil)
-	default:
-		h.EncodeJSON(w, r, http.StatusMethodNotAllowed, "", nil)
+		files = append(files, &service.Upload{
+			Filename: file.Filename,
+			Size:     int64(len(content)),
+			Body:     bytes.NewReader(content),
+		})
+	}
+	if len(files) == 0 {
+		return nil, http.ErrMissingFile
 	}
+	return files, nil
 }
@@ -0,0 +1,584 @@
+package delivery
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"doodocsbackendchallenge/internal/config"
+	"doodocsbackendchallenge/models"
+
+	smtpmock "github.com/mocktools/go-smtp-mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveFilesMimeMismatch(t *testing.T) {
+	h := newTestHandler(t, &config.Config{Limits: config.DefaultLimits(), Mime: config.DefaultMimePolicies()})
+	body, contentType := multipartBody(t, "filestoarchive", "evil.png", []byte("MZ\x90\x00\x03\x00\x00\x00"))
+	req := httptest.NewRequest(http.MethodPost, "/archivefiles", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+
+	h.Handlers().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	assert.Empty(t, rec.Header().Get("Content-Disposition"))
+	var resp struct {
+		Status int
+		Error  struct {
+			Code    string
+			Message string
+			Details mimeDetails
+		}
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.Status)
+	assert.Equal(t, codeMimeMismatch, resp.Error.Code)
+	assert.Equal(t, "evil.png", resp.Error.Details.Filename)
+	assert.Equal(t, "image/png", resp.Error.Details.Claimed)
+	assert.Equal(t, "application/vnd.microsoft.portable-executable", resp.Error.Details.Detected)
+	assert.NotContains(t, resp.Error.Message, "service.")
+	assert.NotContains(t, resp.Error.Message, "\n")
+}
+
+func TestSendEmailsFileMockSMTP(t *testing.T) {
+	server := smtpmock.New(smtpmock.ConfigurationAttr{MultipleMessageReceiving: true})
+	require.NoError(t, server.Start())
+	defer server.Stop()
+
+	cfg := &config.Config{
+		Email:  "sender@example.com",
+		Limits: config.DefaultLimits(),
+		Mime:   config.DefaultMimePolicies(),
+		SMTP: config.SMTP{
+			Host:    "127.0.0.1",
+			Port:    server.PortNumber,
+			TLSMode: config.SMTPTLSNone,
+			Auth:    config.SMTPAuthNone,
+			From:    "relay@example.com",
+		},
+	}
+	h := newTestHandler(t, cfg)
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	part, err := mw.CreateFormFile("fileToGetEmail", "doc.pdf")
+	require.NoError(t, err)
+	_, err = part.Write([]byte("%PDF-1.4\n%test\n"))
+	require.NoError(t, err)
+	require.NoError(t, mw.WriteField("emails", "receiver@example.com, other@example.com"))
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/sendemailandfile", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+
+	h.Handlers().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	var accepted struct {
+		Data models.Job
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &accepted))
+	require.NotEmpty(t, accepted.Data.ID)
+	assert.Equal(t, "/api/v1/jobs/"+accepted.Data.ID, rec.Header().Get("Location"))
+	assert.Equal(t, 2, accepted.Data.Total)
+
+	var job models.Job
+	require.Eventually(t, func() bool {
+		rec := httptest.NewRecorder()
+		h.Handlers().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+accepted.Data.ID, nil))
+		var resp struct {
+			Data models.Job
+		}
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil {
+			return false
+		}
+		job = resp.Data
+		return job.Status == models.JobDone
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, job.Sent)
+	assert.ElementsMatch(t, []models.Delivery{
+		{Email: "receiver@example.com", Status: models.DeliverySent, Attempts: 1},
+		{Email: "other@example.com", Status: models.DeliverySent, Attempts: 1},
+	}, job.Recipients)
+
+	messages := server.Messages()
+	require.Len(t, messages, 2)
+	var rcpts []string
+	for _, msg := range messages {
+		assert.Equal(t, "MAIL FROM:<relay@example.com>", msg.MailfromRequest())
+		assert.Contains(t, msg.MsgRequest(), "doc.pdf")
+		rcpts = append(rcpts, msg.RcpttoRequest())
+	}
+	assert.ElementsMatch(t, []string{"RCPT TO:<receiver@example.com>", "RCPT TO:<other@example.com>"}, rcpts)
+}
+
+func TestJobNotFound(t *testing.T) {
+	h := newTestHandler(t, &config.Config{Limits: config.DefaultLimits()})
+	rec := httptest.NewRecorder()
+	h.Handlers().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestSendEmailsFileTemplate(t *testing.T) {
+	tmplDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmplDir, "invoice.subject.tmpl"), []byte("Invoice {{.number}}"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmplDir, "invoice.html.tmpl"), []byte("<p>Invoice {{.number}}</p>"), 0o644))
+	cfg := &config.Config{
+		Email:  "sender@example.com",
+		Limits: config.DefaultLimits(),
+		Mime:   config.DefaultMimePolicies(),
+		Mailer: config.Mailer{Backend: config.MailerFile, DropDir: t.TempDir(), TemplateDir: tmplDir},
+	}
+	h := newTestHandler(t, cfg)
+
+	send := func(fields map[string]string) *httptest.ResponseRecorder {
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		part, err := mw.CreateFormFile("fileToGetEmail", "doc.pdf")
+		require.NoError(t, err)
+		_, err = part.Write([]byte("%PDF-1.4\n%test\n"))
+		require.NoError(t, err)
+		require.NoError(t, mw.WriteField("emails", "receiver@example.com"))
+		for k, v := range fields {
+			require.NoError(t, mw.WriteField(k, v))
+		}
+		require.NoError(t, mw.Close())
+		req := httptest.NewRequest(http.MethodPost, "/sendemailandfile", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		h.Handlers().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send(map[string]string{"template": "invoice", "variables": `{"number": 42}`, "body": "See attached."})
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	var resp struct {
+		Data models.Job
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, models.Message{Subject: "Invoice 42", Text: "See attached.", HTML: "<p>Invoice 42</p>"}, resp.Data.Message)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, send(map[string]string{"template": "missing"}).Code)
+	assert.Equal(t, http.StatusBadRequest, send(map[string]string{"template": "invoice", "variables": "[1, 2"}).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, send(map[string]string{"template": "invoice"}).Code, "missing variable")
+}
+
+func TestSendEmailsFileAddresses(t *testing.T) {
+	cfg := &config.Config{
+		Email:  "sender@example.com",
+		Limits: config.DefaultLimits(),
+		Mime:   config.DefaultMimePolicies(),
+		Mailer: config.Mailer{Backend: config.MailerFile, DropDir: t.TempDir()},
+	}
+	h := newTestHandler(t, cfg)
+
+	tests := []struct {
+		name   string
+		fields map[string]string
+		status int
+		want   []models.Delivery
+	}{
+		{
+			"Список без пробелов и имена",
+			map[string]string{"emails": `John.Doe@Example.com,"Smith, Jane" <jane@example.com>`, "cc": "boss@example.com"},
+			http.StatusAccepted,
+			[]models.Delivery{
+				{Email: "John.Doe@Example.com", Status: models.DeliveryPending},
+				{Email: "jane@example.com", Name: "Smith, Jane", Status: models.DeliveryPending},
+			},
+		},
+		{"Некорректный получатель", map[string]string{"emails": "a@example.com, nope"}, http.StatusUnprocessableEntity, nil},
+		{"Некорректный reply_to", map[string]string{"emails": "a@example.com", "reply_to": "@@"}, http.StatusUnprocessableEntity, nil},
+		{"Нет получателей", map[string]string{}, http.StatusUnprocessableEntity, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := new(bytes.Buffer)
+			mw := multipart.NewWriter(body)
+			part, err := mw.CreateFormFile("fileToGetEmail", "doc.pdf")
+			require.NoError(t, err)
+			_, err = part.Write([]byte("%PDF-1.4\n%test\n"))
+			require.NoError(t, err)
+			for k, v := range tt.fields {
+				require.NoError(t, mw.WriteField(k, v))
+			}
+			require.NoError(t, mw.Close())
+			req := httptest.NewRequest(http.MethodPost, "/sendemailandfile", body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			rec := httptest.NewRecorder()
+			h.Handlers().ServeHTTP(rec, req)
+
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+			if tt.want == nil {
+				return
+			}
+			var resp struct {
+				Data models.Job
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.want, resp.Data.Recipients)
+			assert.Equal(t, []string{"<boss@example.com>"}, resp.Data.Message.Cc)
+		})
+	}
+}
+
+func TestSendEmailsFileAttachments(t *testing.T) {
+	docx, err := os.ReadFile("../service/testdata/test.docx")
+	require.NoError(t, err)
+	pdf := []byte("%PDF-1.4\n%test\n")
+	const docxType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+	tests := []struct {
+		name    string
+		archive string
+		want    []models.Attachment
+	}{
+		{
+			"Каждый файл отдельным вложением",
+			"",
+			[]models.Attachment{
+				{Filename: "doc.pdf", ContentType: "application/pdf", Size: int64(len(pdf))},
+				{Filename: "test.docx", ContentType: docxType, Size: int64(len(docx))},
+			},
+		},
+		{"Файлы упакованы в архив", "zip", []models.Attachment{{Filename: "archive.zip", ContentType: "application/zip"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dropDir := t.TempDir()
+			h := newTestHandler(t, &config.Config{
+				Email:  "sender@example.com",
+				Limits: config.DefaultLimits(),
+				Mime:   config.DefaultMimePolicies(),
+				Mailer: config.Mailer{Backend: config.MailerFile, DropDir: dropDir},
+			})
+
+			body := new(bytes.Buffer)
+			mw := multipart.NewWriter(body)
+			for name, content := range map[string][]byte{"doc.pdf": pdf, "test.docx": docx} {
+				part, err := mw.CreateFormFile("fileToGetEmail", name)
+				require.NoError(t, err)
+				_, err = part.Write(content)
+				require.NoError(t, err)
+			}
+			require.NoError(t, mw.WriteField("emails", "receiver@example.com"))
+			if tt.archive != "" {
+				require.NoError(t, mw.WriteField("archive", tt.archive))
+			}
+			require.NoError(t, mw.Close())
+			req := httptest.NewRequest(http.MethodPost, "/sendemailandfile", body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			rec := httptest.NewRecorder()
+			h.Handlers().ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+			var resp struct {
+				Data models.Job
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			got := resp.Data.Attachments
+			if tt.archive != "" {
+				require.Len(t, got, 1)
+				assert.Positive(t, got[0].Size)
+				got[0].Size = 0
+			}
+			assert.ElementsMatch(t, tt.want, got)
+
+			// В письме у каждого вложения свой тип, а не application/octet-stream.
+			var files []string
+			require.Eventually(t, func() bool {
+				files, _ = filepath.Glob(filepath.Join(dropDir, "new", "*.eml"))
+				return len(files) == 1
+			}, 5*time.Second, 10*time.Millisecond)
+			parts := readAttachments(t, files[0])
+			require.Len(t, parts, len(tt.want))
+			for _, want := range tt.want {
+				content, ok := parts[want.Filename+" "+want.ContentType]
+				require.True(t, ok, "нет вложения %s типа %s", want.Filename, want.ContentType)
+				if tt.archive == "" {
+					continue
+				}
+				zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+				require.NoError(t, err)
+				var names []string
+				for _, f := range zr.File {
+					names = append(names, f.Name)
+				}
+				assert.ElementsMatch(t, []string{"doc.pdf", "test.docx"}, names)
+			}
+		})
+	}
+
+	t.Run("Неизвестный формат архива", func(t *testing.T) {
+		h := newTestHandler(t, &config.Config{Limits: config.DefaultLimits(), Mime: config.DefaultMimePolicies()})
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		part, err := mw.CreateFormFile("fileToGetEmail", "doc.pdf")
+		require.NoError(t, err)
+		_, err = part.Write(pdf)
+		require.NoError(t, err)
+		require.NoError(t, mw.WriteField("emails", "receiver@example.com"))
+		require.NoError(t, mw.WriteField("archive", "rar"))
+		require.NoError(t, mw.Close())
+		req := httptest.NewRequest(http.MethodPost, "/sendemailandfile", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		h.Handlers().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+// readAttachments returns the attachments of a stored message keyed by
+// "filename content-type".
+func readAttachments(t *testing.T, path string) map[string][]byte {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	msg, err := mail.ReadMessage(f)
+	require.NoError(t, err)
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	attachments := map[string][]byte{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return attachments
+		}
+		require.NoError(t, err)
+		if part.FileName() == "" {
+			continue
+		}
+		mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		content, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+		require.NoError(t, err)
+		attachments[part.FileName()+" "+mediaType] = content
+	}
+}
+
+func TestArchiveAndSendEmail(t *testing.T) {
+	jpg, err := os.ReadFile("../service/testdata/test.jpg")
+	require.NoError(t, err)
+	png, err := os.ReadFile("../service/testdata/test.png")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		limits config.ArchiveEmail
+		files  map[string][]byte
+		fields map[string]string
+		status int
+	}{
+		{
+			"Архив уходит одним вложением",
+			config.DefaultArchiveEmail(),
+			map[string][]byte{"test.jpg": jpg, "test.png": png},
+			map[string]string{"emails": "receiver@example.com", "format": "tar.gz"},
+			http.StatusAccepted,
+		},
+		{
+			"Нет получателей",
+			config.DefaultArchiveEmail(),
+			map[string][]byte{"test.jpg": jpg},
+			map[string]string{},
+			http.StatusUnprocessableEntity,
+		},
+		{
+			"Неизвестный формат",
+			config.DefaultArchiveEmail(),
+			map[string][]byte{"test.jpg": jpg},
+			map[string]string{"emails": "receiver@example.com", "format": "rar"},
+			http.StatusBadRequest,
+		},
+		{
+			"Файл больше лимита части",
+			config.ArchiveEmail{MaxPartSize: 16, MaxRequestSize: 1 << 20, MaxArchiveSize: 1 << 20},
+			map[string][]byte{"test.jpg": jpg},
+			map[string]string{"emails": "receiver@example.com"},
+			http.StatusRequestEntityTooLarge,
+		},
+		{
+			"Архив больше лимита",
+			config.ArchiveEmail{MaxPartSize: 1 << 20, MaxRequestSize: 1 << 20, MaxArchiveSize: 64},
+			map[string][]byte{"test.jpg": jpg, "test.png": png},
+			map[string]string{"emails": "receiver@example.com"},
+			http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dropDir := t.TempDir()
+			h := newTestHandler(t, &config.Config{
+				Email:        "sender@example.com",
+				Limits:       config.DefaultLimits(),
+				Mime:         config.DefaultMimePolicies(),
+				Mailer:       config.Mailer{Backend: config.MailerFile, DropDir: dropDir},
+				ArchiveEmail: tt.limits,
+			})
+
+			body := new(bytes.Buffer)
+			mw := multipart.NewWriter(body)
+			for name, content := range tt.files {
+				part, err := mw.CreateFormFile("filestoarchive", name)
+				require.NoError(t, err)
+				_, err = part.Write(content)
+				require.NoError(t, err)
+			}
+			for k, v := range tt.fields {
+				require.NoError(t, mw.WriteField(k, v))
+			}
+			require.NoError(t, mw.Close())
+			req := httptest.NewRequest(http.MethodPost, "/archiveandsendemail", body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			rec := httptest.NewRecorder()
+			h.Handlers().ServeHTTP(rec, req)
+
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+			if tt.status != http.StatusAccepted {
+				return
+			}
+			var resp struct {
+				Data models.Job
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			require.Len(t, resp.Data.Attachments, 1)
+			assert.Equal(t, "archive.tar.gz", resp.Data.Attachments[0].Filename)
+			assert.Equal(t, "application/gzip", resp.Data.Attachments[0].ContentType)
+
+			var files []string
+			require.Eventually(t, func() bool {
+				files, _ = filepath.Glob(filepath.Join(dropDir, "new", "*.eml"))
+				return len(files) == 1
+			}, 5*time.Second, 10*time.Millisecond)
+			parts := readAttachments(t, files[0])
+			assert.Len(t, parts["archive.tar.gz application/gzip"], int(resp.Data.Attachments[0].Size))
+		})
+	}
+}
+
+func TestSendEmailsDryRun(t *testing.T) {
+	pdf := []byte("%PDF-1.4\n%test\n")
+	tests := []struct {
+		name     string
+		path     string
+		field    string
+		filename string
+		content  []byte
+		dryRun   string
+		status   int
+		code     string
+	}{
+		{"Предпросмотр письма с файлом", "/api/v1/mail/file", "fileToGetEmail", "doc.pdf", pdf, "true", http.StatusOK, ""},
+		{"Предпросмотр письма с архивом", "/api/v1/mail/archive", "filestoarchive", "data.xml", []byte(`<?xml version="1.0"?><a/>`), "1", http.StatusOK, ""},
+		{"Неподдерживаемый тип вложения", "/api/v1/mail/file", "fileToGetEmail", "notes.txt", []byte("plain text"), "true", http.StatusUnsupportedMediaType, codeMimeNotAllowed},
+		{"Неверное значение dry_run", "/api/v1/mail/file", "fileToGetEmail", "doc.pdf", pdf, "maybe", http.StatusBadRequest, codeInvalidDryRun},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dropDir := t.TempDir()
+			h := newTestHandler(t, &config.Config{
+				Email:        "sender@example.com",
+				Limits:       config.DefaultLimits(),
+				Mime:         config.DefaultMimePolicies(),
+				ArchiveEmail: config.DefaultArchiveEmail(),
+				Mailer:       config.Mailer{Backend: config.MailerFile, DropDir: dropDir},
+			})
+
+			body := new(bytes.Buffer)
+			mw := multipart.NewWriter(body)
+			require.NoError(t, mw.WriteField("emails", "one@example.com, two@example.com"))
+			require.NoError(t, mw.WriteField("subject", "Документы"))
+			require.NoError(t, mw.WriteField("dry_run", tt.dryRun))
+			part, err := mw.CreateFormFile(tt.field, tt.filename)
+			require.NoError(t, err)
+			_, err = part.Write(tt.content)
+			require.NoError(t, err)
+			require.NoError(t, mw.Close())
+			req := httptest.NewRequest(http.MethodPost, tt.path, body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			rec := httptest.NewRecorder()
+			h.Handlers().ServeHTTP(rec, req)
+
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.Empty(t, rec.Header().Get("Location"))
+			var resp struct {
+				Data  models.EmailPreview
+				Error *ResponseError
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			if tt.code != "" {
+				require.NotNil(t, resp.Error)
+				assert.Equal(t, tt.code, resp.Error.Code)
+			} else {
+				assert.Equal(t, "sender@example.com", resp.Data.From)
+				assert.Equal(t, []string{"<one@example.com>", "<two@example.com>"}, resp.Data.To)
+				assert.Equal(t, "Документы", resp.Data.Message.Subject)
+				require.Len(t, resp.Data.Attachments, 1)
+				assert.Positive(t, resp.Data.MessageSize)
+			}
+
+			// Ни в одном случае письмо не уходит.
+			time.Sleep(50 * time.Millisecond)
+			files, err := filepath.Glob(filepath.Join(dropDir, "new", "*.eml"))
+			require.NoError(t, err)
+			assert.Empty(t, files)
+		})
+	}
+}
+
+func TestSendEmailsEmailDisabled(t *testing.T) {
+	// Без EMAIL и PASSWORD архивы работают, а почта отвечает 503.
+	h := newTestHandler(t, &config.Config{
+		Limits:       config.DefaultLimits(),
+		Mime:         config.DefaultMimePolicies(),
+		SMTP:         config.DefaultSMTP(),
+		Mailer:       config.DefaultMailer(),
+		ArchiveEmail: config.DefaultArchiveEmail(),
+	})
+	for _, tt := range []struct{ path, field string }{
+		{"/api/v1/mail/file", "fileToGetEmail"},
+		{"/api/v1/mail/archive", "filestoarchive"},
+	} {
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		require.NoError(t, mw.WriteField("emails", "one@example.com"))
+		part, err := mw.CreateFormFile(tt.field, "data.xml")
+		require.NoError(t, err)
+		_, err = part.Write([]byte(`<?xml version="1.0"?><a/>`))
+		require.NoError(t, err)
+		require.NoError(t, mw.Close())
+		req := httptest.NewRequest(http.MethodPost, tt.path, body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		h.Handlers().ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code, tt.path)
+		var resp struct {
+			Error ResponseError
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, codeEmailDisabled, resp.Error.Code)
+	}
+
+	body, contentType := multipartBody(t, "filestoarchive", "data.xml", []byte(`<?xml version="1.0"?><a/>`))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/archive/files", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	h.Handlers().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -1,28 +1,160 @@
 package delivery
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 
+	"doodocsbackendchallenge/internal/config"
 	"doodocsbackendchallenge/internal/service"
 )
 
+// APIPrefix is the path prefix of the current API version.
+const APIPrefix = "/api/v1"
+
 type Handler struct {
 	services *service.Service
 	log      *slog.Logger
+	cfg      *config.Config
 }
 
-func NewHandler(services *service.Service, log *slog.Logger) *Handler {
+func NewHandler(services *service.Service, log *slog.Logger, cfg *config.Config) *Handler {
 	return &Handler{
 		services: services,
 		log:      log,
+		cfg:      cfg,
 	}
 }
 
+// Route is one endpoint of the API. Legacy is the unversioned path it was
+// served on before, kept as a deprecated alias; empty for new endpoints.
+type Route struct {
+	Method  string
+	Path    string
+	Legacy  string
+	handler http.HandlerFunc
+}
+
+// Routes lists every endpoint the handler serves.
+func (h *Handler) Routes() []Route {
+	return []Route{
+		{http.MethodPost, APIPrefix + "/archive/information", "/uploadfilearchive", h.uploadfile_inarchive},
+		{http.MethodPost, APIPrefix + "/archive/files", "/archivefiles", h.archive_files},
+		{http.MethodPost, APIPrefix + "/mail/file", "/sendemailandfile", h.sendemails_file},
+		{http.MethodPost, APIPrefix + "/mail/archive", "/archiveandsendemail", h.archive_send_email},
+		{http.MethodGet, APIPrefix + "/mime/policy", "/mimepolicy", h.mime_policy},
+		{http.MethodGet, APIPrefix + "/jobs/{id}", "/jobs/{id}", h.job},
+		{http.MethodGet, APIPrefix + "/admin/deadletters", "/admin/deadletters", h.adminOnly(h.dead_letters)},
+		{http.MethodPost, APIPrefix + "/admin/deadletters/{id}/replay", "/admin/deadletters/{id}/replay", h.adminOnly(h.replay_dead_letter)},
+		{http.MethodGet, "/openapi.json", "", h.openapi},
+		{http.MethodGet, "/docs", "", h.docs},
+	}
+}
+
+// Handlers registers every route with its method, and its legacy alias.
+// Any other method on a known path gets a 405 with the Allow header.
 func (h *Handler) Handlers() *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/uploadfilearchive", h.uploadfile_inarchive)
-	mux.HandleFunc("/archivefiles", h.archive_files)
-	mux.HandleFunc("/sendemailandfile", h.sendemails_file)
+	allowed := map[string][]string{}
+	var paths []string
+	for _, route := range h.Routes() {
+		handler := h.withTimeouts(route.Path, route.handler)
+		mux.HandleFunc(route.Method+" "+route.Path, handler)
+		if route.Legacy != "" {
+			mux.HandleFunc(route.Method+" "+route.Legacy, deprecated(route.Path, handler))
+		}
+		for _, path := range []string{route.Path, route.Legacy} {
+			if path == "" {
+				continue
+			}
+			if _, ok := allowed[path]; !ok {
+				paths = append(paths, path)
+			}
+			allowed[path] = append(allowed[path], route.Method)
+		}
+	}
+	for _, path := range paths {
+		mux.HandleFunc(path, h.methodNotAllowed(allowed[path]))
+	}
+	for path := range h.cfg.Server.Routes {
+		if _, ok := allowed[path]; !ok {
+			h.log.Warn("timeouts configured for an unknown route", slog.String("path", path))
+		}
+	}
 	return mux
 }
+
+type routeTimeoutsKey struct{}
+
+// withTimeouts applies the timeouts configured for the route, counted from
+// now, and hands them to the handler for streaming. The response only
+// starts once the body is in, so the write deadline never comes before the
+// read deadline, and a route without its own WriteTimeout gets the server
+// one after its read window.
+func (h *Handler) withTimeouts(path string, next http.HandlerFunc) http.HandlerFunc {
+	timeouts, ok := h.cfg.Server.Routes[path]
+	if !ok {
+		return next
+	}
+	write := timeouts.WriteTimeout
+	if write == 0 && timeouts.ReadTimeout > 0 && h.cfg.Server.WriteTimeout > 0 {
+		write = timeouts.ReadTimeout + h.cfg.Server.WriteTimeout
+	}
+	if write > 0 {
+		write = max(write, timeouts.ReadTimeout)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Not every ResponseWriter has deadlines; the server ones then apply.
+		rc := http.NewResponseController(w)
+		if timeouts.ReadTimeout > 0 {
+			rc.SetReadDeadline(time.Now().Add(timeouts.ReadTimeout))
+		}
+		if write > 0 {
+			rc.SetWriteDeadline(time.Now().Add(write))
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), routeTimeoutsKey{}, timeouts)))
+	}
+}
+
+// routeTimeouts are the timeouts withTimeouts applied to the request.
+func routeTimeouts(r *http.Request) config.RouteTimeouts {
+	timeouts, _ := r.Context().Value(routeTimeoutsKey{}).(config.RouteTimeouts)
+	return timeouts
+}
+
+// methodNotAllowed answers 405 listing methods; GET routes also serve HEAD.
+func (h *Handler) methodNotAllowed(methods []string) http.HandlerFunc {
+	allow := slices.Clone(methods)
+	if slices.Contains(allow, http.MethodGet) {
+		allow = append(allow, http.MethodHead)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		h.writeError(w, errMethodNotAllowed)
+	}
+}
+
+// deprecated marks responses of a legacy path and links to its successor,
+// with the path parameters of the request filled in.
+func deprecated(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		segments := strings.Split(successor, "/")
+		for i, s := range segments {
+			if name, ok := strings.CutPrefix(s, "{"); ok {
+				segments[i] = url.PathEscape(r.PathValue(strings.TrimSuffix(name, "}")))
+			}
+		}
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+strings.Join(segments, "/")+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
+
+// jobLocation is the URL of a job for the Location header.
+func jobLocation(id string) string {
+	return APIPrefix + "/jobs/" + id
+}
@@ -0,0 +1,187 @@
+package delivery
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"doodocsbackendchallenge/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteTable(t *testing.T) {
+	h := newTestHandler(t, &config.Config{Limits: config.DefaultLimits(), Mime: config.DefaultMimePolicies()})
+	mux := h.Handlers()
+
+	want := []struct {
+		method string
+		path   string
+		legacy string
+	}{
+		{http.MethodPost, "/api/v1/archive/information", "/uploadfilearchive"},
+		{http.MethodPost, "/api/v1/archive/files", "/archivefiles"},
+		{http.MethodPost, "/api/v1/mail/file", "/sendemailandfile"},
+		{http.MethodPost, "/api/v1/mail/archive", "/archiveandsendemail"},
+		{http.MethodGet, "/api/v1/mime/policy", "/mimepolicy"},
+		{http.MethodGet, "/api/v1/jobs/{id}", "/jobs/{id}"},
+		{http.MethodGet, "/api/v1/admin/deadletters", "/admin/deadletters"},
+		{http.MethodPost, "/api/v1/admin/deadletters/{id}/replay", "/admin/deadletters/{id}/replay"},
+		{http.MethodGet, "/openapi.json", ""},
+		{http.MethodGet, "/docs", ""},
+	}
+	routes := h.Routes()
+	require.Len(t, routes, len(want))
+	for i, route := range routes {
+		assert.Equal(t, want[i].method, route.Method)
+		assert.Equal(t, want[i].path, route.Path)
+		assert.Equal(t, want[i].legacy, route.Legacy)
+	}
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, strings.ReplaceAll(path, "{id}", "abc"), nil))
+		return rec
+	}
+	errorCode := func(t *testing.T, rec *httptest.ResponseRecorder) string {
+		var resp struct {
+			Error *ResponseError
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), rec.Body.String())
+		if resp.Error == nil {
+			return ""
+		}
+		return resp.Error.Code
+	}
+	for _, route := range want {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			// Маршрут доходит до обработчика, а не до текстового 404 или 405 от mux.
+			rec := serve(route.method, route.path)
+			assert.NotContains(t, rec.Header().Get("Content-Type"), "text/plain")
+			assert.NotEqual(t, http.StatusMethodNotAllowed, rec.Code)
+			assert.Empty(t, rec.Header().Get("Deprecation"))
+
+			paths := []string{route.path}
+			if route.legacy != "" {
+				paths = append(paths, route.legacy)
+				// Старый путь работает, но помечен устаревшим.
+				legacy := serve(route.method, route.legacy)
+				assert.Equal(t, rec.Code, legacy.Code)
+				assert.Equal(t, "true", legacy.Header().Get("Deprecation"))
+				assert.Equal(t, `<`+strings.ReplaceAll(route.path, "{id}", "abc")+`>; rel="successor-version"`, legacy.Header().Get("Link"))
+			}
+
+			other, allow := http.MethodGet, "POST"
+			if route.method == http.MethodGet {
+				other, allow = http.MethodPost, "GET, HEAD"
+			}
+			for _, path := range paths {
+				rec := serve(other, path)
+				assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+				assert.Equal(t, allow, rec.Header().Get("Allow"))
+				assert.Equal(t, codeMethodNotAllowed, errorCode(t, rec))
+			}
+		})
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/v1/nope").Code)
+}
+
+func TestRouteReadTimeout(t *testing.T) {
+	h := newTestHandler(t, &config.Config{
+		Limits: config.DefaultLimits(),
+		Server: config.Server{Routes: map[string]config.RouteTimeouts{"/slow": {ReadTimeout: 2 * time.Second}}},
+	})
+	readAll := func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestTimeout)
+			return
+		}
+		assert.Equal(t, config.RouteTimeouts{ReadTimeout: 2 * time.Second}, routeTimeouts(r))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", h.withTimeouts("/slow", readAll))
+	mux.HandleFunc("/fast", h.withTimeouts("/fast", readAll))
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Config.ReadTimeout = 150 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	// Тело приходит дольше ReadTimeout сервера: успевает только маршрут с
+	// собственным таймаутом.
+	slowPost := func(path string) (int, error) {
+		pr, pw := io.Pipe()
+		go func() {
+			for i := 0; i < 4; i++ {
+				time.Sleep(100 * time.Millisecond)
+				if _, err := pw.Write([]byte("data")); err != nil {
+					return
+				}
+			}
+			pw.Close()
+		}()
+		resp, err := http.Post(srv.URL+path, "text/plain", pr)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	status, err := slowPost("/slow")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, err = slowPost("/fast")
+	if err == nil {
+		assert.Equal(t, http.StatusRequestTimeout, status)
+	}
+}
+
+func TestRouteReadTimeoutMovesWriteDeadline(t *testing.T) {
+	// Загрузка дольше WriteTimeout сервера все равно получает ответ:
+	// иначе клиент повторит запрос, а письмо уже в очереди.
+	h := newTestHandler(t, &config.Config{
+		Limits: config.DefaultLimits(),
+		Server: config.Server{
+			WriteTimeout: 150 * time.Millisecond,
+			Routes:       map[string]config.RouteTimeouts{"/slow": {ReadTimeout: 2 * time.Second}},
+		},
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", h.withTimeouts("/slow", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusRequestTimeout)
+			return
+		}
+		w.Write(body)
+	}))
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Config.ReadTimeout = 150 * time.Millisecond
+	srv.Config.WriteTimeout = 150 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < 4; i++ {
+			time.Sleep(100 * time.Millisecond)
+			if _, err := pw.Write([]byte("data")); err != nil {
+				return
+			}
+		}
+		pw.Close()
+	}()
+	resp, err := http.Post(srv.URL+"/slow", "text/plain", pr)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "datadatadatadata", string(body))
+}
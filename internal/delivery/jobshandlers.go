@@ -0,0 +1,21 @@
+package delivery
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// job reports the progress of a background email job.
+func (h *Handler) job(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.job"
+	log := h.log.With(
+		slog.String("op", op),
+	)
+	job, err := h.services.Job(r.PathValue("id"))
+	if err != nil {
+		log.Error(err.Error())
+		h.writeError(w, err)
+		return
+	}
+	h.EncodeJSON(w, http.StatusOK, job)
+}
@@ -0,0 +1,161 @@
+package delivery
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+
+	"doodocsbackendchallenge/internal/config"
+	"doodocsbackendchallenge/internal/service"
+)
+
+// maxFieldSize bounds plain (non-file) form values such as "emails".
+const maxFieldSize = 1 << 20
+
+// PartTooLargeError is returned when a single form part exceeds its limit.
+type PartTooLargeError struct {
+	Part  string
+	Limit int64
+}
+
+func (e *PartTooLargeError) Error() string {
+	return fmt.Sprintf("part %q exceeds the limit of %d bytes", e.Part, e.Limit)
+}
+
+// multipartUploads streams the files of one form field to the service as
+// they arrive and collects the plain fields seen on the way.
+type multipartUploads struct {
+	mr      *multipart.Reader
+	field   string
+	limit   int64
+	query   url.Values
+	values  url.Values
+	pending *multipart.Part
+	current *multipart.Part
+}
+
+func newMultipartUploads(w http.ResponseWriter, r *http.Request, field string, limits config.Limits) (*multipartUploads, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, limits.MaxRequestSize)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	return &multipartUploads{
+		mr:     mr,
+		field:  field,
+		limit:  limits.MaxPartSize,
+		query:  r.URL.Query(),
+		values: url.Values{},
+	}, nil
+}
+
+// Peek reads ahead to the first file of the field so that plain fields sent
+// before it are available through Value.
+func (m *multipartUploads) Peek() error {
+	if m.pending != nil {
+		return nil
+	}
+	part, err := m.nextFilePart()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	m.pending = part
+	return nil
+}
+
+// Value returns a plain form field, falling back to the query string.
+func (m *multipartUploads) Value(key string) string {
+	if value := m.values.Get(key); value != "" {
+		return value
+	}
+	return m.query.Get(key)
+}
+
+func (m *multipartUploads) Next() (*service.Upload, error) {
+	if m.current != nil {
+		m.current.Close()
+		m.current = nil
+	}
+	part := m.pending
+	m.pending = nil
+	if part == nil {
+		var err error
+		part, err = m.nextFilePart()
+		if err != nil {
+			return nil, err
+		}
+	}
+	m.current = part
+	return &service.Upload{
+		Filename: part.FileName(),
+		Size:     -1,
+		Body:     &limitedPart{r: part, name: part.FileName(), left: m.limit, limit: m.limit},
+	}, nil
+}
+
+// Drain reads the remaining parts so that trailing plain fields are collected.
+func (m *multipartUploads) Drain() error {
+	for {
+		_, err := m.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (m *multipartUploads) nextFilePart() (*multipart.Part, error) {
+	for {
+		part, err := m.mr.NextPart()
+		if err == io.EOF {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errMalformedForm, err)
+		}
+		if part.FileName() == "" {
+			value, err := io.ReadAll(&limitedPart{r: part, name: part.FormName(), left: maxFieldSize, limit: maxFieldSize})
+			if err != nil {
+				return nil, err
+			}
+			m.values.Add(part.FormName(), string(value))
+			continue
+		}
+		if part.FormName() != m.field {
+			part.Close()
+			continue
+		}
+		return part, nil
+	}
+}
+
+// limitedPart fails with PartTooLargeError once more than limit bytes are
+// read. Other read errors mean the body broke off mid-part.
+type limitedPart struct {
+	r     io.Reader
+	name  string
+	left  int64
+	limit int64
+}
+
+func (l *limitedPart) Read(p []byte) (int, error) {
+	if l.left < 0 {
+		return 0, &PartTooLargeError{Part: l.name, Limit: l.limit}
+	}
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+	if l.left < 0 {
+		return n + int(l.left), &PartTooLargeError{Part: l.name, Limit: l.limit}
+	}
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %w", errMalformedForm, err)
+	}
+	return n, err
+}
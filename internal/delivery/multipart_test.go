@@ -0,0 +1,139 @@
+package delivery
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"doodocsbackendchallenge/internal/config"
+	"doodocsbackendchallenge/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler(t *testing.T, cfg *config.Config) *Handler {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	// Как в main: без отправителя и учётных данных почта выключена.
+	var mailer service.Mailer
+	if cfg.CheckEmail() == nil {
+		var err error
+		mailer, err = service.NewMailer(cfg)
+		require.NoError(t, err)
+	}
+	jobs, err := service.OpenBoltJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	templates, err := service.LoadTemplates(cfg.Mailer.TemplateDir)
+	require.NoError(t, err)
+	services := service.NewServices(log, cfg, mailer, jobs, templates)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		services.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		jobs.Close()
+	})
+	return NewHandler(services, log, cfg)
+}
+
+func multipartBody(t *testing.T, field, filename string, content []byte) (*bytes.Buffer, string) {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	part, err := mw.CreateFormFile(field, filename)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+	return body, mw.FormDataContentType()
+}
+
+func TestUploadLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits config.Limits
+		part   string
+		code   string
+	}{
+		{name: "part limit", limits: config.Limits{MaxPartSize: 16, MaxRequestSize: 1 << 20}, part: "big.zip", code: codePartTooLarge},
+		{name: "request limit", limits: config.Limits{MaxPartSize: 1 << 20, MaxRequestSize: 64}, code: codeRequestTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, &config.Config{Limits: tt.limits})
+			body, contentType := multipartBody(t, "myFile", "big.zip", bytes.Repeat([]byte("x"), 1024))
+			req := httptest.NewRequest(http.MethodPost, "/uploadfilearchive", body)
+			req.Header.Set("Content-Type", contentType)
+			rec := httptest.NewRecorder()
+
+			h.Handlers().ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+			var resp struct {
+				Error struct {
+					Code    string
+					Details limitDetails
+				}
+			}
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			assert.Equal(t, tt.code, resp.Error.Code)
+			assert.Equal(t, tt.part, resp.Error.Details.Part)
+			assert.NotZero(t, resp.Error.Details.Limit)
+		})
+	}
+}
+
+func TestUploadBrokenBody(t *testing.T) {
+	// Тело оборвалось посреди архива: виноват запрос, а не архив
+	archive := new(bytes.Buffer)
+	tw := tar.NewWriter(archive)
+	content := bytes.Repeat([]byte("a"), 64<<10)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0o644, Size: int64(len(content))}))
+	_, err := tw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	h := newTestHandler(t, &config.Config{Limits: config.DefaultLimits(), Mime: config.DefaultMimePolicies()})
+	body, contentType := multipartBody(t, "myFile", "a.tar", archive.Bytes())
+	req := httptest.NewRequest(http.MethodPost, "/uploadfilearchive", bytes.NewReader(body.Bytes()[:body.Len()/2]))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+
+	h.Handlers().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var resp struct {
+		Error struct {
+			Code    string
+			Message string
+		}
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, codeMalformedRequest, resp.Error.Code)
+	assert.Equal(t, "malformed multipart form", resp.Error.Message)
+}
+
+func TestLimitedPart(t *testing.T) {
+	r := &limitedPart{r: bytes.NewReader([]byte("12345")), name: "f", left: 5, limit: 5}
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "12345", string(data))
+
+	r = &limitedPart{r: bytes.NewReader([]byte("123456")), name: "f", left: 5, limit: 5}
+	data, err = io.ReadAll(r)
+	var partErr *PartTooLargeError
+	require.ErrorAs(t, err, &partErr)
+	assert.Equal(t, "12345", string(data))
+}
@@ -0,0 +1,27 @@
+package delivery
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec documents every route of Handler.Routes. TestOpenAPIMatchesRoutes
+// fails when the two drift apart.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// docsPage renders openAPISpec in the browser without external assets.
+//
+//go:embed docs.html
+var docsPage []byte
+
+func (h *Handler) openapi(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+func (h *Handler) docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
@@ -0,0 +1,113 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"doodocsbackendchallenge/internal/config"
+	"doodocsbackendchallenge/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type openAPIDoc struct {
+	OpenAPI string `json:"openapi"`
+	Paths   map[string]map[string]struct {
+		OperationID string `json:"operationId"`
+		Deprecated  bool   `json:"deprecated"`
+	} `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadOpenAPI(t *testing.T) openAPIDoc {
+	var doc openAPIDoc
+	require.NoError(t, json.Unmarshal(openAPISpec, &doc))
+	return doc
+}
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	doc := loadOpenAPI(t)
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+
+	h := newTestHandler(t, &config.Config{Limits: config.DefaultLimits()})
+	routes := map[string]bool{}
+	for _, route := range h.Routes() {
+		routes[strings.ToLower(route.Method)+" "+route.Path] = false
+		if route.Legacy != "" {
+			routes[strings.ToLower(route.Method)+" "+route.Legacy] = true
+		}
+	}
+	documented := map[string]bool{}
+	ids := map[string]bool{}
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			documented[method+" "+path] = op.Deprecated
+			assert.False(t, ids[op.OperationID], "повтор operationId %s", op.OperationID)
+			ids[op.OperationID] = true
+		}
+	}
+	// Ключ — маршрут, значение — помечен ли он устаревшим.
+	assert.Equal(t, routes, documented)
+}
+
+func TestOpenAPISchemasMatchModels(t *testing.T) {
+	doc := loadOpenAPI(t)
+	tests := []struct {
+		schema string
+		model  any
+	}{
+		{"Archive", models.Archive{}},
+		{"File", models.File{}},
+		{"Attachment", models.Attachment{}},
+		{"Message", models.Message{}},
+		{"Delivery", models.Delivery{}},
+		{"Job", models.Job{}},
+		{"EmailPreview", models.EmailPreview{}},
+		{"DeadLetter", models.DeadLetter{}},
+		{"MimePolicies", config.MimePolicies{}},
+		{"MimePolicy", config.MimePolicy{}},
+		{"Envelope", Response{}},
+		{"Error", ResponseError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			schema, ok := doc.Components.Schemas[tt.schema]
+			require.True(t, ok, "схема не описана")
+			var want, got []string
+			typ := reflect.TypeOf(tt.model)
+			for i := 0; i < typ.NumField(); i++ {
+				name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+				want = append(want, name)
+			}
+			for name := range schema.Properties {
+				got = append(got, name)
+			}
+			assert.ElementsMatch(t, want, got)
+		})
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	h := newTestHandler(t, &config.Config{Limits: config.DefaultLimits()})
+
+	rec := httptest.NewRecorder()
+	h.Handlers().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, string(openAPISpec), rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	h.Handlers().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `fetch("/openapi.json")`)
+}
@@ -0,0 +1,10 @@
+package delivery
+
+import (
+	"net/http"
+)
+
+// mime_policy shows the mime allow and deny lists currently enforced per endpoint.
+func (h *Handler) mime_policy(w http.ResponseWriter, r *http.Request) {
+	h.EncodeJSON(w, http.StatusOK, h.cfg.Mime)
+}
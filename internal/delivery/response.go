@@ -2,45 +2,47 @@ package delivery
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"net/http"
-	"strconv"
 )
 
+// ResponseVersion is bumped whenever the envelope changes shape.
+const ResponseVersion = 1
+
+// Response is the envelope of every JSON response. Status repeats the HTTP
+// status code; exactly one of Error and Data is set, except that Data may
+// be empty on success.
 type Response struct {
-	Status string `json:"status"`
-	Data   interface{}
+	Version int            `json:"version"`
+	Status  int            `json:"status"`
+	Error   *ResponseError `json:"error,omitempty"`
+	Data    interface{}    `json:"data,omitempty"`
 }
 
-type contextKey struct {
-	name string
+// ResponseError is the machine-readable error of a failed request.
+type ResponseError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
 }
 
-var StatusCtxKey = contextKey{"Status"}
-
-func Status(r *http.Request, status int) {
-	*r = *r.WithContext(context.WithValue(r.Context(), StatusCtxKey, status))
+// EncodeJSON writes data in the envelope with the given status.
+func (h *Handler) EncodeJSON(w http.ResponseWriter, status int, data interface{}) {
+	h.writeResponse(w, Response{Version: ResponseVersion, Status: status, Data: data})
 }
 
-func (h *Handler) EncodeJSON(w http.ResponseWriter, r *http.Request, status int, message string, data interface{}) {
+func (h *Handler) writeResponse(w http.ResponseWriter, resp Response) {
 	buf := &bytes.Buffer{}
 	enc := json.NewEncoder(buf)
 	enc.SetEscapeHTML(true)
-	resp := Response{
-		Status: strconv.Itoa(status) + http.StatusText(status),
-		Data:   data,
-	}
 	if err := enc.Encode(resp); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.log.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	if status, ok := r.Context().Value(StatusCtxKey).(int); ok {
-		w.WriteHeader(status)
-	}
+	w.WriteHeader(resp.Status)
 	if _, err := w.Write(buf.Bytes()); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		h.log.Error(err.Error())
 	}
 }
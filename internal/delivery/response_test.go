@@ -0,0 +1,88 @@
+package delivery
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"doodocsbackendchallenge/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseStatuses(t *testing.T) {
+	zipData, err := os.ReadFile("../service/testdata/test.zip")
+	require.NoError(t, err)
+	h := newTestHandler(t, &config.Config{Limits: config.DefaultLimits(), Mime: config.DefaultMimePolicies()})
+
+	upload := func() (io.Reader, string) {
+		return multipartBody(t, "myFile", "test.zip", zipData)
+	}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   func() (io.Reader, string)
+		status int
+		code   string
+	}{
+		{"Разбор архива", http.MethodPost, "/uploadfilearchive", upload, http.StatusOK, ""},
+		{"Политика mime", http.MethodGet, "/mimepolicy", nil, http.StatusOK, ""},
+		{"Неизвестная задача", http.MethodGet, "/jobs/missing", nil, http.StatusNotFound, codeNotFound},
+		{"Неверный метод", http.MethodGet, "/sendemailandfile", nil, http.StatusMethodNotAllowed, codeMethodNotAllowed},
+		{"Админка выключена", http.MethodGet, "/admin/deadletters", nil, http.StatusForbidden, codeForbidden},
+		{"Тело не multipart", http.MethodPost, "/uploadfilearchive", func() (io.Reader, string) {
+			return strings.NewReader("{}"), "application/json"
+		}, http.StatusBadRequest, codeMalformedRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			contentType := ""
+			if tt.body != nil {
+				body, contentType = tt.body()
+			}
+			req := httptest.NewRequest(tt.method, tt.path, body)
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			rec := httptest.NewRecorder()
+			h.Handlers().ServeHTTP(rec, req)
+
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			var resp struct {
+				Version int
+				Status  int
+				Error   *ResponseError
+				Data    json.RawMessage
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, ResponseVersion, resp.Version)
+			assert.Equal(t, tt.status, resp.Status, "статус в теле совпадает с HTTP")
+			if tt.code == "" {
+				assert.Nil(t, resp.Error)
+				assert.NotEmpty(t, resp.Data)
+				return
+			}
+			require.NotNil(t, resp.Error)
+			assert.Equal(t, tt.code, resp.Error.Code)
+			assert.NotEmpty(t, resp.Error.Message)
+			assert.Empty(t, resp.Data)
+		})
+	}
+}
+
+func TestEncodeJSONWritesStatus(t *testing.T) {
+	h := newTestHandler(t, &config.Config{Limits: config.DefaultLimits()})
+	rec := httptest.NewRecorder()
+	h.EncodeJSON(rec, http.StatusCreated, map[string]string{"id": "1"})
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.JSONEq(t, `{"version":1,"status":201,"data":{"id":"1"}}`, rec.Body.String())
+}
@@ -0,0 +1,47 @@
+package delivery
+
+import (
+	"net/http"
+	"time"
+)
+
+// archiveErrorTrailer carries the failure reason when an archive stream
+// breaks after the status line and part of the body were already sent.
+const archiveErrorTrailer = "X-Archive-Error"
+
+// streamWriter forwards writes to the client and flushes them right away,
+// so archive bytes leave as chunks instead of piling up in the response.
+// With a chunk timeout each write first moves the write deadline that far
+// ahead, so the stream may outlive the write timeout while it progresses.
+type streamWriter struct {
+	w            http.ResponseWriter
+	rc           *http.ResponseController
+	chunkTimeout time.Duration
+	written      int64
+}
+
+func newStreamWriter(w http.ResponseWriter, chunkTimeout time.Duration) *streamWriter {
+	return &streamWriter{w: w, rc: http.NewResponseController(w), chunkTimeout: chunkTimeout}
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.chunkTimeout > 0 {
+		if err := s.rc.SetWriteDeadline(time.Now().Add(s.chunkTimeout)); err != nil && err != http.ErrNotSupported {
+			return 0, err
+		}
+	}
+	n, err := s.w.Write(p)
+	s.written += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if err := s.rc.Flush(); err != nil && err != http.ErrNotSupported {
+		return n, err
+	}
+	return n, nil
+}
+
+// started reports whether any body bytes already reached the client.
+func (s *streamWriter) started() bool {
+	return s.written > 0
+}
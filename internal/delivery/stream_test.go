@@ -0,0 +1,51 @@
+package delivery
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamWriterExtendsWriteDeadline(t *testing.T) {
+	tests := []struct {
+		name         string
+		chunkTimeout time.Duration
+		complete     bool
+	}{
+		{"Без продления поток обрывается по WriteTimeout", 0, false},
+		{"Каждый кусок продлевает срок записи", 300 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				stream := newStreamWriter(w, tt.chunkTimeout)
+				for i := 0; i < 4; i++ {
+					time.Sleep(100 * time.Millisecond)
+					if _, err := stream.Write([]byte("chunk\n")); err != nil {
+						return
+					}
+				}
+			}))
+			srv.Config.WriteTimeout = 150 * time.Millisecond
+			srv.Start()
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if tt.complete {
+				require.NoError(t, err)
+				assert.Equal(t, strings.Repeat("chunk\n", 4), string(body))
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
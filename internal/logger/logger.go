@@ -1,12 +1,39 @@
 package logger
 
 import (
+	"io"
 	"log/slog"
 	"os"
+
+	"doodocsbackendchallenge/internal/config"
 )
 
-func SetupLogger() *slog.Logger {
-	log := &slog.Logger{}
-	log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
-	return log
+// SetupLogger logs with the level and format of cfg.Log. Secret values of
+// cfg are replaced in every message and string attribute, errors included,
+// so a secret that leaks into an error never reaches the output.
+func SetupLogger(cfg *config.Config) *slog.Logger {
+	return newLogger(os.Stdout, cfg)
+}
+
+func newLogger(w io.Writer, cfg *config.Config) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level: cfg.Log.SlogLevel(),
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			return redactAttr(cfg, a)
+		},
+	}
+	if cfg.Log.Format == config.LogFormatText {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+func redactAttr(cfg *config.Config, a slog.Attr) slog.Attr {
+	switch v := a.Value.Any().(type) {
+	case string:
+		a.Value = slog.StringValue(cfg.Redact(v))
+	case error:
+		a.Value = slog.StringValue(cfg.Redact(v.Error()))
+	}
+	return a
 }
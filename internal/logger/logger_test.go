@@ -0,0 +1,34 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"doodocsbackendchallenge/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggerRedactsSecrets(t *testing.T) {
+	cfg := &config.Config{Log: config.DefaultLog(), Password: config.NewSecret("hunter2")}
+	cfg.Admin.Token = config.NewSecret("t0ken")
+
+	for _, format := range []string{config.LogFormatJSON, config.LogFormatText} {
+		t.Run(format, func(t *testing.T) {
+			cfg.Log.Format = format
+			var buf bytes.Buffer
+			log := newLogger(&buf, cfg)
+			log.Error("auth failed for hunter2",
+				slog.String("token", "Bearer t0ken"),
+				slog.Any("error", errors.New("535 hunter2 rejected")),
+				slog.Any("config", cfg),
+			)
+			out := buf.String()
+			assert.NotContains(t, out, "hunter2")
+			assert.NotContains(t, out, "t0ken")
+			assert.Contains(t, out, "[REDACTED]")
+		})
+	}
+}
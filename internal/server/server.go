@@ -2,26 +2,133 @@ package server
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"log/slog"
+	"net"
 	"net/http"
-	"time"
+	"sync"
+
+	"doodocsbackendchallenge/internal/config"
 )
 
 type Server struct {
-	srv http.Server
+	// Log gets certificate reload messages. Nil means slog.Default().
+	Log *slog.Logger
+
+	mu       sync.Mutex
+	srv      *http.Server
+	redirect *http.Server
+}
+
+// Start serves handlers with the server-wide timeouts of cfg. Per-route
+// timeouts are applied by the handlers themselves. With cfg.TLS enabled it
+// serves HTTPS and, if cfg.TLS.RedirectAddr is set, redirects plain HTTP
+// there too.
+func (s *Server) Start(cfg config.Server, handlers http.Handler) error {
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return err
+	}
+	var redirectLn net.Listener
+	if cfg.TLS.Enabled() && cfg.TLS.RedirectAddr != "" {
+		redirectLn, err = net.Listen("tcp", cfg.TLS.RedirectAddr)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+	}
+	return s.serve(ln, redirectLn, cfg, handlers)
 }
 
-func (s *Server) Start(port string, handlers http.Handler) error {
-	s.srv = http.Server{
-		Addr:         port,
-		Handler:      handlers,
-		WriteTimeout: time.Second * 3,
-		ReadTimeout:  time.Second * 3,
+// serve is Start on listeners that are already open.
+func (s *Server) serve(ln, redirectLn net.Listener, cfg config.Server, handlers http.Handler) error {
+	log := s.Log
+	if log == nil {
+		log = slog.Default()
+	}
+
+	srv := &http.Server{
+		Handler:           handlers,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	if !cfg.TLS.Enabled() {
+		s.setServers(srv, nil)
+		return srv.Serve(ln)
+	}
+
+	certs, err := newCertReloader(cfg.TLS, log)
+	if err != nil {
+		ln.Close()
+		if redirectLn != nil {
+			redirectLn.Close()
+		}
+		return err
 	}
-	fmt.Printf("Server starting http://localhost%s\n", port)
-	return s.srv.ListenAndServe()
+	srv.TLSConfig = certs.TLSConfig()
+
+	var redirect *http.Server
+	errs := make(chan error, 1)
+	if redirectLn != nil {
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+		redirect = &http.Server{
+			Handler:           redirectToHTTPS(port),
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		}
+		go func() {
+			errs <- redirect.Serve(redirectLn)
+		}()
+	}
+	s.setServers(srv, redirect)
+
+	err = srv.ServeTLS(ln, "", "")
+	if redirect != nil {
+		// The redirect listener is only useful next to the HTTPS one.
+		redirect.Close()
+		if rerr := <-errs; !errors.Is(rerr, http.ErrServerClosed) {
+			err = errors.Join(err, rerr)
+		}
+	}
+	return err
+}
+
+func (s *Server) setServers(srv, redirect *http.Server) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.srv, s.redirect = srv, redirect
+}
+
+// redirectToHTTPS sends every request to the same host and path on the
+// HTTPS port. 308 keeps the method and body of uploads.
+func redirectToHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.srv.Shutdown(ctx)
+	s.mu.Lock()
+	srv, redirect := s.srv, s.redirect
+	s.mu.Unlock()
+
+	var errs []error
+	if redirect != nil {
+		errs = append(errs, redirect.Shutdown(ctx))
+	}
+	if srv != nil {
+		errs = append(errs, srv.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
 }
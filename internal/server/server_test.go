@@ -0,0 +1,317 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"doodocsbackendchallenge/internal/config"
+)
+
+// testCert is a self-signed CA or a certificate issued by one.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	tls  tls.Certificate
+}
+
+// newTestCert issues a certificate for name signed by parent, or a CA when
+// parent is nil.
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{
+		cert: cert,
+		key:  key,
+		tls:  tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert},
+	}
+}
+
+func (c *testCert) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+}
+
+func (c *testCert) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+// writeFiles puts the certificate and key in dir as cert.pem and key.pem.
+// The mtime is moved forward so a rewrite within the same second is seen.
+func (c *testCert) writeFiles(t *testing.T, dir string, mtime time.Time) config.TLS {
+	t.Helper()
+	cfg := config.TLS{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}
+	require.NoError(t, os.WriteFile(cfg.CertFile, c.certPEM(), 0o600))
+	require.NoError(t, os.WriteFile(cfg.KeyFile, c.keyPEM(t), 0o600))
+	require.NoError(t, os.Chtimes(cfg.CertFile, mtime, mtime))
+	require.NoError(t, os.Chtimes(cfg.KeyFile, mtime, mtime))
+	return cfg
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// startTestServer serves a handler answering "ok" on a random port and
+// returns its https:// and, with a redirect listener, http:// addresses.
+func startTestServer(t *testing.T, tlsCfg config.TLS, redirect bool) (string, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	var redirectLn net.Listener
+	redirectURL := ""
+	if redirect {
+		redirectLn, err = net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		redirectURL = "http://" + redirectLn.Addr().String()
+	}
+
+	cfg := config.DefaultServer()
+	cfg.TLS = tlsCfg
+	srv := &Server{Log: testLogger()}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.serve(ln, redirectLn, cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "ok")
+		}))
+	}()
+	t.Cleanup(func() {
+		require.NoError(t, srv.Shutdown(context.Background()))
+		assert.ErrorIs(t, <-done, http.ErrServerClosed)
+	})
+	// Shutdown must see the servers, so wait until serve has set them.
+	require.Eventually(t, func() bool {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return srv.srv != nil
+	}, time.Second, time.Millisecond)
+	return "https://" + ln.Addr().String(), redirectURL
+}
+
+func testClient(ca *testCert, cert *testCert) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	tlsCfg := &tls.Config{RootCAs: pool}
+	if cert != nil {
+		tlsCfg.Certificates = []tls.Certificate{cert.tls}
+	}
+	return &http.Client{
+		// С собственным TLSClientConfig HTTP/2 включается только явно.
+		Transport: &http.Transport{TLSClientConfig: tlsCfg, ForceAttemptHTTP2: true},
+		// Редирект проверяется сам по себе.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		Timeout:       5 * time.Second,
+	}
+}
+
+func get(t *testing.T, client *http.Client, url string) (*http.Response, error) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp, err
+}
+
+func TestServeTLS(t *testing.T) {
+	ca := newTestCert(t, "test CA", nil)
+	serverCert := newTestCert(t, "localhost", ca)
+	url, _ := startTestServer(t, serverCert.writeFiles(t, t.TempDir(), time.Now()), false)
+
+	resp, err := get(t, testClient(ca, nil), url)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotNil(t, resp.TLS)
+	assert.Equal(t, serverCert.cert.SerialNumber, resp.TLS.PeerCertificates[0].SerialNumber)
+	// Сервер предлагает h2 через ALPN.
+	assert.Equal(t, "HTTP/2.0", resp.Proto)
+	assert.Equal(t, "h2", resp.TLS.NegotiatedProtocol)
+
+	// Сертификат, подписанный чужим CA, клиент не принимает.
+	_, err = get(t, testClient(newTestCert(t, "other CA", nil), nil), url)
+	assert.Error(t, err)
+}
+
+func TestServeTLSBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	cfg := config.DefaultServer()
+	cfg.TLS = config.TLS{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: filepath.Join(dir, "missing.pem")}
+
+	srv := &Server{Log: testLogger()}
+	assert.Error(t, srv.serve(ln, nil, cfg, http.NotFoundHandler()))
+	// Слушатель закрыт, порт не остаётся занятым.
+	_, err = ln.Accept()
+	assert.Error(t, err)
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test CA", nil)
+	first := newTestCert(t, "localhost", ca)
+	mtime := time.Now()
+	cfg := first.writeFiles(t, dir, mtime)
+
+	reloader, err := newCertReloader(cfg, testLogger())
+	require.NoError(t, err)
+	reloader.checkEvery = 0
+	serial := func() *big.Int {
+		leaf, err := x509.ParseCertificate(reloader.current().Certificates[0].Certificate[0])
+		require.NoError(t, err)
+		return leaf.SerialNumber
+	}
+	assert.Equal(t, first.cert.SerialNumber, serial())
+
+	// Обновлённые файлы подхватываются без перезапуска.
+	second := newTestCert(t, "localhost", ca)
+	mtime = mtime.Add(time.Minute)
+	second.writeFiles(t, dir, mtime)
+	assert.Equal(t, second.cert.SerialNumber, serial())
+
+	// Битый файл не ломает сервер: остаётся предыдущий сертификат.
+	require.NoError(t, os.WriteFile(cfg.CertFile, []byte("not a certificate"), 0o600))
+	mtime = mtime.Add(time.Minute)
+	require.NoError(t, os.Chtimes(cfg.CertFile, mtime, mtime))
+	assert.Equal(t, second.cert.SerialNumber, serial())
+
+	// Файлы проверяются не чаще раза в checkEvery.
+	reloader.checkEvery = time.Hour
+	third := newTestCert(t, "localhost", ca)
+	third.writeFiles(t, dir, mtime.Add(time.Minute))
+	assert.Equal(t, second.cert.SerialNumber, serial())
+}
+
+func TestServeTLSReloadsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test CA", nil)
+	first := newTestCert(t, "localhost", ca)
+	mtime := time.Now()
+	url, _ := startTestServer(t, first.writeFiles(t, dir, mtime), false)
+
+	serial := func() *big.Int {
+		// Новое соединение на каждый запрос, иначе рукопожатия не будет.
+		resp, err := get(t, testClient(ca, nil), url)
+		require.NoError(t, err)
+		return resp.TLS.PeerCertificates[0].SerialNumber
+	}
+	assert.Equal(t, first.cert.SerialNumber, serial())
+
+	second := newTestCert(t, "localhost", ca)
+	second.writeFiles(t, dir, mtime.Add(time.Minute))
+	assert.Eventually(t, func() bool {
+		return serial().Cmp(second.cert.SerialNumber) == 0
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test CA", nil)
+	clientCA := newTestCert(t, "client CA", nil)
+	cfg := newTestCert(t, "localhost", ca).writeFiles(t, dir, time.Now())
+	cfg.ClientCAFile = filepath.Join(dir, "clients.pem")
+	require.NoError(t, os.WriteFile(cfg.ClientCAFile, clientCA.certPEM(), 0o600))
+	url, _ := startTestServer(t, cfg, false)
+
+	tests := []struct {
+		name   string
+		client *testCert
+		ok     bool
+	}{
+		{"Клиент с сертификатом от доверенного CA", newTestCert(t, "client", clientCA), true},
+		{"Клиент без сертификата", nil, false},
+		{"Клиент с сертификатом от чужого CA", newTestCert(t, "client", newTestCert(t, "other CA", nil)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := get(t, testClient(ca, tt.client), url)
+			if !tt.ok {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	ca := newTestCert(t, "test CA", nil)
+	url, redirectURL := startTestServer(t, newTestCert(t, "localhost", ca).writeFiles(t, t.TempDir(), time.Now()), true)
+
+	// Перенаправление ведёт на HTTPS-порт, путь и запрос сохраняются.
+	client := testClient(ca, nil)
+	resp, err := client.Post(redirectURL+"/api/v1/mail/file?x=1", "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, url+"/api/v1/mail/file?x=1", resp.Header.Get("Location"))
+
+	tests := []struct {
+		name string
+		port string
+		host string
+		want string
+	}{
+		{"Стандартный порт не указывается", "443", "example.com:80", "https://example.com/a?b=c"},
+		{"Нестандартный порт", "8443", "example.com", "https://example.com:8443/a?b=c"},
+		{"IPv6", "8443", "[::1]:8080", "https://[::1]:8443/a?b=c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/a?b=c", nil)
+			r.Host = tt.host
+			w := httptest.NewRecorder()
+			redirectToHTTPS(tt.port).ServeHTTP(w, r)
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+			assert.Equal(t, tt.want, w.Header().Get("Location"))
+		})
+	}
+}
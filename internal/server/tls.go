@@ -0,0 +1,150 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"doodocsbackendchallenge/internal/config"
+)
+
+// reloadCheckInterval is how often a handshake may stat the certificate
+// files to see whether they changed.
+const reloadCheckInterval = time.Second
+
+// certReloader hands every TLS handshake the certificate and client CA pool
+// read from disk, and reads them again once the files change, e.g. after
+// certbot renews the certificate. A broken renewal keeps the old files in
+// use and is logged.
+type certReloader struct {
+	cfg        config.TLS
+	log        *slog.Logger
+	checkEvery time.Duration
+
+	mu        sync.Mutex
+	tlsCfg    *tls.Config
+	stamps    []fileStamp
+	checkedAt time.Time
+}
+
+// fileStamp tells whether a file changed since it was read.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func newCertReloader(cfg config.TLS, log *slog.Logger) (*certReloader, error) {
+	const op = "server.newCertReloader"
+
+	r := &certReloader{cfg: cfg, log: log, checkEvery: reloadCheckInterval}
+	if err := r.load(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return r, nil
+}
+
+// TLSConfig is the config for http.Server: everything per connection comes
+// from GetConfigForClient. GetCertificate is only there so the server sees
+// a certificate source.
+func (r *certReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current(), nil
+		},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &r.current().Certificates[0], nil
+		},
+	}
+}
+
+// current reloads the files if they changed and returns the config to use.
+func (r *certReloader) current() *tls.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) < r.checkEvery {
+		return r.tlsCfg
+	}
+	r.checkedAt = time.Now()
+
+	stamps, err := r.stat()
+	if err != nil || !r.changed(stamps) {
+		return r.tlsCfg
+	}
+	if err := r.load(); err != nil {
+		r.log.Error("failed to reload TLS certificate, keeping the old one", slog.String("error", err.Error()))
+		// Don't retry until the files change again.
+		r.stamps = stamps
+		return r.tlsCfg
+	}
+	r.log.Info("TLS certificate reloaded", slog.String("cert_file", r.cfg.CertFile))
+	return r.tlsCfg
+}
+
+// load reads the files and replaces the config.
+func (r *certReloader) load() error {
+	stamps, err := r.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+		Certificates: []tls.Certificate{cert},
+	}
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New(r.cfg.ClientCAFile + ": no certificates found")
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	r.tlsCfg = tlsCfg
+	r.stamps = stamps
+	return nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+func (r *certReloader) stat() ([]fileStamp, error) {
+	var stamps []fileStamp
+	for _, name := range r.files() {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		stamps = append(stamps, fileStamp{modTime: info.ModTime(), size: info.Size()})
+	}
+	return stamps, nil
+}
+
+func (r *certReloader) changed(stamps []fileStamp) bool {
+	for i := range stamps {
+		if !stamps[i].modTime.Equal(r.stamps[i].modTime) || stamps[i].size != r.stamps[i].size {
+			return true
+		}
+	}
+	return false
+}
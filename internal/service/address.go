@@ -0,0 +1,78 @@
+package service
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// Recipients are the parsed addresses of one send request. Every address
+// in To gets its own message, with Cc shown in each of them. Every Cc and
+// Bcc address gets one copy per request, addressed to all of To; Bcc never
+// appears in the headers.
+type Recipients struct {
+	To      []*mail.Address
+	Cc      []*mail.Address
+	Bcc     []*mail.Address
+	ReplyTo []*mail.Address
+}
+
+// ParseRecipients parses RFC 5322 address lists such as
+// `"Doe, John" <John.Doe@Example.com>, jane@example.com`. All lists are
+// checked before anything is sent and To must not be empty.
+func ParseRecipients(to, cc, bcc, replyTo string) (Recipients, error) {
+	var r Recipients
+	var err error
+	if r.To, err = parseAddressList("emails", to); err != nil {
+		return Recipients{}, err
+	}
+	if len(r.To) == 0 {
+		return Recipients{}, &AddressError{Field: "emails", Err: errNoRecipients}
+	}
+	if r.Cc, err = parseAddressList("cc", cc); err != nil {
+		return Recipients{}, err
+	}
+	if r.Bcc, err = parseAddressList("bcc", bcc); err != nil {
+		return Recipients{}, err
+	}
+	if r.ReplyTo, err = parseAddressList("reply_to", replyTo); err != nil {
+		return Recipients{}, err
+	}
+	return r, nil
+}
+
+func parseAddressList(field, list string) ([]*mail.Address, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	addrs, err := mail.ParseAddressList(list)
+	if err != nil {
+		return nil, &AddressError{Field: field, Input: list, Err: err}
+	}
+	return addrs, nil
+}
+
+// copyAddresses lists every Cc and Bcc address once, leaving out those
+// that already get a message as a To recipient.
+func (r Recipients) copyAddresses() []*mail.Address {
+	seen := map[string]bool{}
+	for _, addr := range r.To {
+		seen[strings.ToLower(addr.Address)] = true
+	}
+	var copies []*mail.Address
+	for _, addr := range append(append([]*mail.Address{}, r.Cc...), r.Bcc...) {
+		if key := strings.ToLower(addr.Address); !seen[key] {
+			seen[key] = true
+			copies = append(copies, addr)
+		}
+	}
+	return copies
+}
+
+// formatAddresses renders addresses for a header, keeping display names.
+func formatAddresses(addrs []*mail.Address) []string {
+	var out []string
+	for _, addr := range addrs {
+		out = append(out, addr.String())
+	}
+	return out
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"doodocsbackendchallenge/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRecipients(t *testing.T) {
+	tests := []struct {
+		name      string
+		to        string
+		cc        string
+		wantTo    []string
+		wantField string
+	}{
+		{"Заглавные буквы", "John.Doe@Example.com", "", []string{"John.Doe@Example.com"}, ""},
+		{"Запятая без пробела", "a@b.com,c@d.com", "", []string{"a@b.com", "c@d.com"}, ""},
+		{"Запятая с пробелом", "a@b.com, c@d.com", "", []string{"a@b.com", "c@d.com"}, ""},
+		{"Отображаемое имя с запятой", `"Doe, John" <john@example.com>, jane@example.com`, "", []string{"john@example.com", "jane@example.com"}, ""},
+		{"Некорректный адрес", "not-an-email", "", nil, "emails"},
+		{"Пустой список", " ", "", nil, "emails"},
+		{"Некорректная копия", "a@b.com", "broken@", nil, "cc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipients, err := ParseRecipients(tt.to, tt.cc, "", "")
+			if tt.wantField != "" {
+				var addrErr *AddressError
+				require.ErrorAs(t, err, &addrErr)
+				assert.Equal(t, tt.wantField, addrErr.Field)
+				assert.ErrorIs(t, err, ErrInvalidAddress)
+				return
+			}
+			require.NoError(t, err)
+			var got []string
+			for _, addr := range recipients.To {
+				got = append(got, addr.Address)
+			}
+			assert.Equal(t, tt.wantTo, got)
+		})
+	}
+}
+
+func TestEmailQueueCopies(t *testing.T) {
+	store, err := OpenBoltJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	dir := t.TempDir()
+	q := newTestQueue(t, store, &FileMailer{Dir: dir})
+	runQueue(t, q)
+
+	recipients, err := ParseRecipients(`"Doe, John" <John.Doe@Example.com>, two@example.com, three@example.com`,
+		"Boss <boss@example.com>, TWO@example.com", "audit@example.com, boss@example.com", "support@example.com")
+	require.NoError(t, err)
+	job, err := q.EnqueueEmail(recipients, EmailContent{}, oneUpload("doc.pdf", []byte("%PDF-1.4\n%test\n")), nil)
+	require.NoError(t, err)
+	job = waitJobDone(t, q, job.ID)
+	assert.Equal(t, 5, job.Total)
+	assert.Equal(t, 5, job.Sent)
+	assert.Equal(t, []models.Delivery{
+		{Email: "John.Doe@Example.com", Name: "Doe, John", Status: models.DeliverySent, Attempts: 1},
+		{Email: "two@example.com", Status: models.DeliverySent, Attempts: 1},
+		{Email: "three@example.com", Status: models.DeliverySent, Attempts: 1},
+	}, job.Recipients)
+	// Каждая копия отправляется один раз на задачу; адрес из To копию не получает.
+	assert.Equal(t, []models.Delivery{
+		{Email: "boss@example.com", Name: "Boss", Status: models.DeliverySent, Attempts: 1},
+		{Email: "audit@example.com", Status: models.DeliverySent, Attempts: 1},
+	}, job.Copies)
+
+	files, err := filepath.Glob(filepath.Join(dir, "new", "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 5)
+	envelopes := map[string]*mail.Message{}
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		require.NoError(t, err)
+		msg := string(raw)
+		// Скрытая копия есть только в конверте, не в заголовках.
+		assert.NotContains(t, strings.Replace(msg, "X-Envelope-To: audit@example.com\r\n", "", 1), "audit@example.com")
+		parsed, err := mail.ReadMessage(strings.NewReader(msg))
+		require.NoError(t, err)
+		envelopes[parsed.Header.Get("X-Envelope-To")] = parsed
+	}
+	require.Len(t, envelopes, 5, "у каждого письма в конверте один адрес")
+
+	headerAddresses := func(msg *mail.Message, header string) []string {
+		addrs, err := msg.Header.AddressList(header)
+		require.NoError(t, err, header)
+		var out []string
+		for _, addr := range addrs {
+			out = append(out, addr.Address)
+		}
+		return out
+	}
+	allTo := []string{"John.Doe@Example.com", "two@example.com", "three@example.com"}
+	for envelope, wantTo := range map[string][]string{
+		"John.Doe@Example.com": {"John.Doe@Example.com"},
+		"two@example.com":      {"two@example.com"},
+		"three@example.com":    {"three@example.com"},
+		"boss@example.com":     allTo,
+		"audit@example.com":    allTo,
+	} {
+		msg := envelopes[envelope]
+		require.NotNil(t, msg, envelope)
+		assert.Equal(t, wantTo, headerAddresses(msg, "To"), envelope)
+		assert.Equal(t, []string{"boss@example.com", "TWO@example.com"}, headerAddresses(msg, "Cc"), envelope)
+		assert.Equal(t, []string{"support@example.com"}, headerAddresses(msg, "Reply-To"), envelope)
+		assert.Empty(t, msg.Header.Get("Bcc"), envelope)
+	}
+}
+
+func TestEmailQueueRejectedCopy(t *testing.T) {
+	store, err := OpenBoltJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	q := newTestQueue(t, store, &flakyMailer{fail: "boss@example.com"})
+	runQueue(t, q)
+
+	recipients, err := ParseRecipients("one@example.com, two@example.com", "boss@example.com", "", "")
+	require.NoError(t, err)
+	job, err := q.EnqueueEmail(recipients, EmailContent{}, oneUpload("doc.pdf", []byte("%PDF-1.4\n%test\n")), nil)
+	require.NoError(t, err)
+	job = waitJobDone(t, q, job.ID)
+
+	// Отказ по копии не затрагивает получателей из To.
+	assert.Equal(t, []models.Delivery{
+		{Email: "one@example.com", Status: models.DeliverySent, Attempts: 1},
+		{Email: "two@example.com", Status: models.DeliverySent, Attempts: 1},
+	}, job.Recipients)
+	assert.Equal(t, []models.Delivery{
+		{Email: "boss@example.com", Status: models.DeliveryFailed, Attempts: 1, Error: `550 "mailbox unavailable"`},
+	}, job.Copies)
+	assert.Equal(t, 2, job.Sent)
+	assert.Equal(t, 1, job.Failed)
+
+	letters, err := q.DeadLetters()
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, "boss@example.com", letters[0].Email)
+
+	// Повтор отправляет письмо только этому адресу, копии заново не рассылаются.
+	replayed, err := q.ReplayDeadLetter(letters[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed.Total)
+	assert.Empty(t, replayed.Copies)
+}
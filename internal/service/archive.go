@@ -0,0 +1,273 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/nwaples/rardecode/v2"
+)
+
+// Decoders allocate their window up front from a size the archive states,
+// so a few bytes could otherwise claim gigabytes. zstd defaults stay within
+// 8MB; 7-Zip ultra and WinRAR use dictionaries of up to 64MB.
+const (
+	maxZstdWindow        = 8 << 20
+	maxArchiveDictionary = 64 << 20
+)
+
+// ArchiveEntry is one member of an archive. Body is only valid inside the
+// callback passed to ArchiveReader.Walk and is nil for directories.
+type ArchiveEntry struct {
+	Name  string
+	Size  int64
+	IsDir bool
+	Body  io.Reader
+}
+
+// ArchiveReader lists the members of a single container format.
+type ArchiveReader interface {
+	// Format is the short name reported in errors and logs, e.g. "tar.gz".
+	Format() string
+	// Match reports whether the leading bytes of a file belong to this format.
+	Match(magic []byte) bool
+	// Walk calls fn for every member of the archive in order.
+	Walk(r io.ReaderAt, size int64, fn func(ArchiveEntry) error) error
+}
+
+// StreamArchiveReader is implemented by formats that can be walked in a
+// single forward pass, so uploads of that format never need buffering.
+type StreamArchiveReader interface {
+	ArchiveReader
+	WalkStream(r io.Reader, fn func(ArchiveEntry) error) error
+}
+
+// DefaultArchiveReaders returns the formats understood by UploadFileGetJSON.
+func DefaultArchiveReaders() []ArchiveReader {
+	return []ArchiveReader{
+		zipArchiveReader{},
+		tarArchiveReader{},
+		gzipTarArchiveReader{},
+		zstdTarArchiveReader{},
+		sevenZipArchiveReader{},
+		rarArchiveReader{},
+	}
+}
+
+// detectArchiveReader picks the first reader whose magic bytes match.
+func detectArchiveReader(readers []ArchiveReader, magic []byte) (ArchiveReader, error) {
+	for _, ar := range readers {
+		if ar.Match(magic) {
+			return ar, nil
+		}
+	}
+	return nil, ErrUnsupportedArchive
+}
+
+type zipArchiveReader struct{}
+
+func (zipArchiveReader) Format() string { return "zip" }
+
+func (zipArchiveReader) Match(magic []byte) bool {
+	return bytes.HasPrefix(magic, []byte("PK\x03\x04")) || bytes.HasPrefix(magic, []byte("PK\x05\x06"))
+}
+
+func (zipArchiveReader) Walk(r io.ReaderAt, size int64, fn func(ArchiveEntry) error) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	return walkZip(zr, fn)
+}
+
+func walkZip(zr *zip.Reader, fn func(ArchiveEntry) error) error {
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() {
+			if err := fn(ArchiveEntry{Name: file.Name, IsDir: true}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := walkOpened(file.Name, int64(file.UncompressedSize64), file.Open, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkArchive walks r in one pass when the format allows it and buffers
+// it in memory for formats that need random access.
+func walkArchive(reader ArchiveReader, r io.Reader, fn func(ArchiveEntry) error) error {
+	if sr, ok := reader.(StreamArchiveReader); ok {
+		return sr.WalkStream(r, fn)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return reader.Walk(bytes.NewReader(data), int64(len(data)), fn)
+}
+
+// walkOpened opens a random-access archive member, hands it to fn and closes it.
+func walkOpened(name string, size int64, open func() (io.ReadCloser, error), fn func(ArchiveEntry) error) error {
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return fn(ArchiveEntry{Name: name, Size: size, Body: rc})
+}
+
+type tarArchiveReader struct{}
+
+func (tarArchiveReader) Format() string { return "tar" }
+
+func (tarArchiveReader) Match(magic []byte) bool {
+	return len(magic) >= 262 && bytes.Equal(magic[257:262], []byte("ustar"))
+}
+
+func (ar tarArchiveReader) Walk(r io.ReaderAt, size int64, fn func(ArchiveEntry) error) error {
+	return ar.WalkStream(io.NewSectionReader(r, 0, size), fn)
+}
+
+func (tarArchiveReader) WalkStream(r io.Reader, fn func(ArchiveEntry) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		entry := ArchiveEntry{Name: hdr.Name, Size: hdr.Size}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			entry.IsDir = true
+			entry.Size = 0
+		case tar.TypeReg:
+			entry.Body = tr
+		default:
+			// Links, devices and PAX metadata carry no file content.
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+type gzipTarArchiveReader struct{}
+
+func (gzipTarArchiveReader) Format() string { return "tar.gz" }
+
+func (gzipTarArchiveReader) Match(magic []byte) bool {
+	return bytes.HasPrefix(magic, []byte{0x1f, 0x8b})
+}
+
+func (ar gzipTarArchiveReader) Walk(r io.ReaderAt, size int64, fn func(ArchiveEntry) error) error {
+	return ar.WalkStream(io.NewSectionReader(r, 0, size), fn)
+}
+
+func (gzipTarArchiveReader) WalkStream(r io.Reader, fn func(ArchiveEntry) error) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	return tarArchiveReader{}.WalkStream(gz, fn)
+}
+
+type zstdTarArchiveReader struct{}
+
+func (zstdTarArchiveReader) Format() string { return "tar.zst" }
+
+func (zstdTarArchiveReader) Match(magic []byte) bool {
+	return bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd})
+}
+
+func (ar zstdTarArchiveReader) Walk(r io.ReaderAt, size int64, fn func(ArchiveEntry) error) error {
+	return ar.WalkStream(io.NewSectionReader(r, 0, size), fn)
+}
+
+func (zstdTarArchiveReader) WalkStream(r io.Reader, fn func(ArchiveEntry) error) error {
+	zr, err := zstd.NewReader(r,
+		zstd.WithDecoderMaxWindow(maxZstdWindow),
+		zstd.WithDecoderLowmem(true),
+		zstd.WithDecoderConcurrency(1),
+	)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	return tarArchiveReader{}.WalkStream(zr, fn)
+}
+
+type sevenZipArchiveReader struct{}
+
+func (sevenZipArchiveReader) Format() string { return "7z" }
+
+func (sevenZipArchiveReader) Match(magic []byte) bool {
+	return bytes.HasPrefix(magic, []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c})
+}
+
+func (sevenZipArchiveReader) Walk(r io.ReaderAt, size int64, fn func(ArchiveEntry) error) error {
+	if err := checkSevenZipDictionaries(r, size); err != nil {
+		return err
+	}
+	sz, err := sevenzip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, file := range sz.File {
+		if file.FileInfo().IsDir() {
+			if err := fn(ArchiveEntry{Name: file.Name, IsDir: true}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := walkOpened(file.Name, int64(file.UncompressedSize), file.Open, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type rarArchiveReader struct{}
+
+func (rarArchiveReader) Format() string { return "rar" }
+
+func (rarArchiveReader) Match(magic []byte) bool {
+	return bytes.HasPrefix(magic, []byte("Rar!\x1a\x07"))
+}
+
+func (ar rarArchiveReader) Walk(r io.ReaderAt, size int64, fn func(ArchiveEntry) error) error {
+	return ar.WalkStream(io.NewSectionReader(r, 0, size), fn)
+}
+
+func (rarArchiveReader) WalkStream(r io.Reader, fn func(ArchiveEntry) error) error {
+	rr, err := rardecode.NewReader(r, rardecode.MaxDictionarySize(maxArchiveDictionary))
+	if err != nil {
+		return err
+	}
+	for {
+		hdr, err := rr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		entry := ArchiveEntry{Name: hdr.Name, Size: hdr.UnPackedSize, IsDir: hdr.IsDir}
+		if !hdr.IsDir {
+			entry.Body = rr
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"io"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// pngSignature starts every generated body, so the content matches the
+// .png extension the uploads claim.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// patternReader produces size bytes of a PNG signature followed by a
+// repeating pattern without allocating them.
+type patternReader struct {
+	off  int64
+	left int64
+}
+
+func (p *patternReader) Read(b []byte) (int, error) {
+	if p.left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > p.left {
+		b = b[:p.left]
+	}
+	for i := range b {
+		if k := p.off + int64(i); k < int64(len(pngSignature)) {
+			b[i] = pngSignature[k]
+		} else {
+			b[i] = byte(k % 251)
+		}
+	}
+	p.off += int64(len(b))
+	p.left -= int64(len(b))
+	return len(b), nil
+}
+
+// generatedUploads yields count images of size bytes each and records the
+// peak heap seen between files. With unknownSize the uploads report size
+// -1, like parts of a streamed form.
+type generatedUploads struct {
+	count       int
+	size        int64
+	unknownSize bool
+	peakHeap    uint64
+}
+
+func (g *generatedUploads) Next() (*Upload, error) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if stats.HeapInuse > g.peakHeap {
+		g.peakHeap = stats.HeapInuse
+	}
+	if g.count == 0 {
+		return nil, io.EOF
+	}
+	g.count--
+	size := g.size
+	if g.unknownSize {
+		size = -1
+	}
+	return &Upload{
+		Filename: "image" + strconv.Itoa(g.count) + ".png",
+		Size:     size,
+		Body:     &patternReader{left: g.size},
+	}, nil
+}
+
+// BenchmarkArchiveInFilesStreaming archives batches of growing size into
+// io.Discard. peak-heap-MB stays flat as the batch grows to 1 GB because
+// entries are copied straight to the writer. tar entries of unknown size
+// hold at most tarMemoryBuffer in memory and spill the rest to disk.
+//
+//	go test ./internal/service -run '^$' -bench ArchiveInFilesStreaming -benchtime 1x
+func BenchmarkArchiveInFilesStreaming(b *testing.B) {
+	const fileSize = 64 << 20
+	service := &FileService{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	for _, total := range []int64{64 << 20, 256 << 20, 1 << 30} {
+		for _, tc := range []struct {
+			name        string
+			format      string
+			unknownSize bool
+		}{
+			{"zip", "zip", false},
+			{"tar", "tar", false},
+			{"tar-unknown-size", "tar", true},
+		} {
+			format, err := LookupArchiveFormat(tc.format)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(tc.name+"/"+strconv.FormatInt(total>>20, 10)+"MB", func(b *testing.B) {
+				b.SetBytes(total)
+				var peak uint64
+				for i := 0; i < b.N; i++ {
+					runtime.GC()
+					uploads := &generatedUploads{count: int(total / fileSize), size: fileSize, unknownSize: tc.unknownSize}
+					if err := service.ArchiveInFiles(io.Discard, uploads, format); err != nil {
+						b.Fatal(err)
+					}
+					if uploads.peakHeap > peak {
+						peak = uploads.peakHeap
+					}
+				}
+				b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MB")
+			})
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ArchiveFormat is an output container that ArchiveInFiles can produce.
+type ArchiveFormat struct {
+	Name        string
+	ContentType string
+	Extension   string
+	newWriter   func(w io.Writer) (archiveWriter, error)
+}
+
+// Filename is the attachment name sent to the client, e.g. "archive.tar.gz".
+func (f ArchiveFormat) Filename() string {
+	return "archive." + f.Extension
+}
+
+// archiveWriter adds entries to an output archive. A negative size means
+// the length is unknown until the entry has been written. Abort releases
+// what an unfinished archive holds, such as temporary files, and does
+// nothing after Close.
+type archiveWriter interface {
+	Create(name string, size int64) (io.Writer, error)
+	Close() error
+	Abort()
+}
+
+var archiveFormats = []ArchiveFormat{
+	{Name: "zip", ContentType: "application/zip", Extension: "zip", newWriter: newZipArchiveWriter},
+	{Name: "tar", ContentType: "application/x-tar", Extension: "tar", newWriter: newTarArchiveWriter},
+	{Name: "tar.gz", ContentType: "application/gzip", Extension: "tar.gz", newWriter: newGzipTarArchiveWriter},
+	{Name: "tar.zst", ContentType: "application/zstd", Extension: "tar.zst", newWriter: newZstdTarArchiveWriter},
+}
+
+// DefaultArchiveFormat is used when the client does not ask for a format.
+var DefaultArchiveFormat = archiveFormats[0]
+
+// LookupArchiveFormat resolves a format name such as "tar.gz"; an empty
+// name selects DefaultArchiveFormat.
+func LookupArchiveFormat(name string) (ArchiveFormat, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return DefaultArchiveFormat, nil
+	}
+	switch name {
+	case "tgz":
+		name = "tar.gz"
+	case "tzst":
+		name = "tar.zst"
+	}
+	for _, format := range archiveFormats {
+		if format.Name == name {
+			return format, nil
+		}
+	}
+	return ArchiveFormat{}, &UnsupportedFormatError{Format: name}
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func newZipArchiveWriter(w io.Writer) (archiveWriter, error) {
+	return &zipArchiveWriter{zw: zip.NewWriter(w)}, nil
+}
+
+func (z *zipArchiveWriter) Create(name string, _ int64) (io.Writer, error) {
+	return z.zw.Create(name)
+}
+
+func (z *zipArchiveWriter) Close() error {
+	return z.zw.Close()
+}
+
+func (z *zipArchiveWriter) Abort() {}
+
+type tarArchiveWriter struct {
+	tw         *tar.Writer
+	compressor io.WriteCloser
+	pending    *pendingTarEntry
+}
+
+// tarMemoryBuffer is how much of an entry of unknown size is held in
+// memory before the rest goes to a temporary file.
+const tarMemoryBuffer = 4 << 20
+
+// pendingTarEntry holds an entry of unknown size until it is complete,
+// because tar records the size in the header ahead of the content. Past
+// tarMemoryBuffer it spills to a temporary file, so memory stays bounded
+// however large the entry is. The file is unlinked as soon as it is
+// created and goes away with its descriptor.
+type pendingTarEntry struct {
+	name  string
+	buf   bytes.Buffer
+	spill *os.File
+	size  int64
+}
+
+func (p *pendingTarEntry) Write(b []byte) (int, error) {
+	if p.spill == nil && p.buf.Len()+len(b) > tarMemoryBuffer {
+		f, err := os.CreateTemp("", "archive-entry-*")
+		if err != nil {
+			return 0, err
+		}
+		os.Remove(f.Name())
+		p.spill = f
+		if _, err := p.buf.WriteTo(f); err != nil {
+			return 0, err
+		}
+	}
+	var n int
+	var err error
+	if p.spill != nil {
+		n, err = p.spill.Write(b)
+	} else {
+		n, err = p.buf.Write(b)
+	}
+	p.size += int64(n)
+	return n, err
+}
+
+// writeTo copies the content to w and releases the temporary file.
+func (p *pendingTarEntry) writeTo(w io.Writer) error {
+	if p.spill == nil {
+		_, err := p.buf.WriteTo(w)
+		return err
+	}
+	defer p.close()
+	if _, err := p.spill.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, p.spill)
+	return err
+}
+
+func (p *pendingTarEntry) close() {
+	if p.spill != nil {
+		p.spill.Close()
+		p.spill = nil
+	}
+}
+
+func newTarArchiveWriter(w io.Writer) (archiveWriter, error) {
+	return &tarArchiveWriter{tw: tar.NewWriter(w)}, nil
+}
+
+func newGzipTarArchiveWriter(w io.Writer) (archiveWriter, error) {
+	gz := gzip.NewWriter(w)
+	return &tarArchiveWriter{tw: tar.NewWriter(gz), compressor: gz}, nil
+}
+
+func newZstdTarArchiveWriter(w io.Writer) (archiveWriter, error) {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return &tarArchiveWriter{tw: tar.NewWriter(zw), compressor: zw}, nil
+}
+
+func (t *tarArchiveWriter) Create(name string, size int64) (io.Writer, error) {
+	if err := t.flushPending(); err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		t.pending = &pendingTarEntry{name: name}
+		return t.pending, nil
+	}
+	if err := t.writeHeader(name, size); err != nil {
+		return nil, err
+	}
+	return t.tw, nil
+}
+
+func (t *tarArchiveWriter) flushPending() error {
+	if t.pending == nil {
+		return nil
+	}
+	pending := t.pending
+	t.pending = nil
+	if err := t.writeHeader(pending.name, pending.size); err != nil {
+		pending.close()
+		return err
+	}
+	return pending.writeTo(t.tw)
+}
+
+func (t *tarArchiveWriter) writeHeader(name string, size int64) error {
+	return t.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0o644,
+		Size:     size,
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatPAX,
+	})
+}
+
+func (t *tarArchiveWriter) Abort() {
+	if t.pending != nil {
+		t.pending.close()
+		t.pending = nil
+	}
+}
+
+func (t *tarArchiveWriter) Close() error {
+	if err := t.flushPending(); err != nil {
+		return err
+	}
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	if t.compressor != nil {
+		return t.compressor.Close()
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"doodocsbackendchallenge/internal/config"
+	"doodocsbackendchallenge/models"
+)
+
+// emailAttachment is one file of an email with its detected type.
+type emailAttachment struct {
+	models.Attachment
+	Content []byte
+}
+
+// readAttachments reads every file, checking it against the Email policy.
+// With an archive format the files are packed into a single archive by the
+// ArchiveInFiles pipeline instead of being attached one by one.
+func (flsrv *FileService) readAttachments(files Uploads, archive *ArchiveFormat) ([]emailAttachment, error) {
+	policy := flsrv.mimePolicies().Email
+	var attachments []emailAttachment
+	for {
+		file, err := files.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		detected, body, err := sniffUpload(file.Filename, file.Body)
+		if err != nil {
+			return nil, err
+		}
+		if !policy.Allows(mimeNames(policy, detected)...) {
+			return nil, &MimeNotAllowedError{Filename: file.Filename, Detected: detected.String()}
+		}
+		content, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		_, fn := filepath.Split(file.Filename)
+		attachments = append(attachments, emailAttachment{
+			Attachment: models.Attachment{
+				Filename:    fn,
+				ContentType: detected.String(),
+				Size:        int64(len(content)),
+			},
+			Content: content,
+		})
+	}
+	if len(attachments) == 0 {
+		return nil, http.ErrMissingFile
+	}
+	if archive == nil {
+		return attachments, nil
+	}
+	attachment, err := flsrv.archiveAttachment(attachmentUploads(attachments), *archive, policy, 0)
+	if err != nil {
+		return nil, err
+	}
+	return []emailAttachment{attachment}, nil
+}
+
+// archiveAttachment packs files into one archive attachment. limit caps
+// the archive size in bytes; 0 means no cap.
+func (flsrv *FileService) archiveAttachment(files Uploads, format ArchiveFormat, policy config.MimePolicy, limit int64) (emailAttachment, error) {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	if limit > 0 {
+		w = &cappedWriter{w: &buf, left: limit, limit: limit}
+	}
+	if err := flsrv.archiveFiles(w, files, format, policy); err != nil {
+		return emailAttachment{}, err
+	}
+	return emailAttachment{
+		Attachment: models.Attachment{
+			Filename:    format.Filename(),
+			ContentType: format.ContentType,
+			Size:        int64(buf.Len()),
+		},
+		Content: buf.Bytes(),
+	}, nil
+}
+
+// cappedWriter fails with ArchiveTooLargeError once more than limit bytes
+// are written.
+type cappedWriter struct {
+	w     io.Writer
+	left  int64
+	limit int64
+}
+
+func (c *cappedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > c.left {
+		return 0, &ArchiveTooLargeError{Limit: c.limit}
+	}
+	c.left -= int64(len(p))
+	return c.w.Write(p)
+}
+
+func attachmentUploads(attachments []emailAttachment) Uploads {
+	uploads := make([]*Upload, len(attachments))
+	for i, a := range attachments {
+		uploads[i] = &Upload{Filename: a.Filename, Size: a.Size, Body: bytes.NewReader(a.Content)}
+	}
+	return MemoryUploads(uploads...)
+}
+
+// splitAttachments separates what a job stores as metadata from the bytes.
+func splitAttachments(attachments []emailAttachment) ([]models.Attachment, [][]byte) {
+	meta := make([]models.Attachment, len(attachments))
+	blobs := make([][]byte, len(attachments))
+	for i, a := range attachments {
+		meta[i], blobs[i] = a.Attachment, a.Content
+	}
+	return meta, blobs
+}
+
+func joinAttachments(meta []models.Attachment, blobs [][]byte) ([]emailAttachment, error) {
+	if len(meta) != len(blobs) {
+		return nil, fmt.Errorf("%d attachments stored for %d files", len(blobs), len(meta))
+	}
+	attachments := make([]emailAttachment, len(meta))
+	for i := range meta {
+		attachments[i] = emailAttachment{Attachment: meta[i], Content: blobs[i]}
+	}
+	return attachments, nil
+}
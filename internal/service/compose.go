@@ -0,0 +1,64 @@
+package service
+
+import (
+	"strings"
+
+	"doodocsbackendchallenge/models"
+)
+
+// Content of messages sent without a subject or body.
+const (
+	defaultSubject = "Doodocs Backend Challenge"
+	defaultText    = "Hello i'm testing smtp."
+)
+
+// EmailContent is what a request asks to send: a template rendered with
+// Variables, literal Subject, Text and HTML, or both, in which case the
+// literal parts replace the rendered ones.
+type EmailContent struct {
+	Subject   string
+	Text      string
+	HTML      string
+	Template  string
+	Variables map[string]any
+}
+
+func (flsrv *FileService) composeMessage(content EmailContent) (models.Message, error) {
+	var msg models.Message
+	if content.Template != "" {
+		var err error
+		if msg, err = flsrv.templates.Render(content.Template, content.Variables); err != nil {
+			return models.Message{}, err
+		}
+	}
+	if content.Subject != "" {
+		msg.Subject = content.Subject
+	}
+	if content.Text != "" {
+		msg.Text = content.Text
+	}
+	if content.HTML != "" {
+		msg.HTML = content.HTML
+	}
+	// A header cannot span lines.
+	msg.Subject = strings.Join(strings.Fields(msg.Subject), " ")
+	if msg.Subject == "" {
+		msg.Subject = defaultSubject
+	}
+	if msg.Text == "" && msg.HTML == "" {
+		msg.Text = defaultText
+	}
+	return msg, nil
+}
+
+// recipientMessage is composeMessage with the copy recipients filled in.
+func (flsrv *FileService) recipientMessage(recipients Recipients, content EmailContent) (models.Message, error) {
+	message, err := flsrv.composeMessage(content)
+	if err != nil {
+		return models.Message{}, err
+	}
+	message.Cc = formatAddresses(recipients.Cc)
+	message.Bcc = formatAddresses(recipients.Bcc)
+	message.ReplyTo = formatAddresses(recipients.ReplyTo)
+	return message, nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedArchive is returned when no ArchiveReader recognizes the upload.
+var ErrUnsupportedArchive = errors.New("unsupported archive format")
+
+// ErrUnsupportedFormat is wrapped by UnsupportedFormatError.
+var ErrUnsupportedFormat = errors.New("unsupported output format")
+
+// ErrMimeMismatch is wrapped by MimeMismatchError.
+var ErrMimeMismatch = errors.New("content does not match file extension")
+
+// ErrEmailDisabled is returned by every email operation when the service
+// runs without a mailer, see config.CheckEmail.
+var ErrEmailDisabled = errors.New("email is disabled")
+
+// ErrJobNotFound is returned for an unknown job ID.
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrUnsafePath is wrapped by UnsafePathError so callers can match it with errors.Is.
+var ErrUnsafePath = errors.New("unsafe path in archive")
+
+// UnsafePathError reports an archive entry whose name is absolute or
+// escapes the archive root (zip-slip).
+type UnsafePathError struct {
+	Name string
+}
+
+func (e *UnsafePathError) Error() string {
+	return fmt.Sprintf("%s: %q", ErrUnsafePath, e.Name)
+}
+
+func (e *UnsafePathError) Unwrap() error {
+	return ErrUnsafePath
+}
+
+// UnsupportedFormatError reports an output archive format the service cannot write.
+type UnsupportedFormatError struct {
+	Format string
+}
+
+func (e *UnsupportedFormatError) Error() string {
+	return fmt.Sprintf("%s: %q", ErrUnsupportedFormat, e.Format)
+}
+
+func (e *UnsupportedFormatError) Unwrap() error {
+	return ErrUnsupportedFormat
+}
+
+// MimeMismatchError reports an upload whose content type differs from the
+// type claimed by its file extension, e.g. an executable renamed to .png.
+type MimeMismatchError struct {
+	Filename string
+	Claimed  string
+	Detected string
+}
+
+func (e *MimeMismatchError) Error() string {
+	return fmt.Sprintf("%s: %q claims %s but contains %s", ErrMimeMismatch, e.Filename, e.Claimed, e.Detected)
+}
+
+func (e *MimeMismatchError) Unwrap() error {
+	return ErrMimeMismatch
+}
+
+// ErrDeadLetterNotFound is returned for an unknown dead letter ID.
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// PermanentError marks a delivery failure that retrying cannot fix.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// ErrTemplate is matched by every TemplateError.
+var ErrTemplate = errors.New("email template error")
+
+// ErrUnknownTemplate is returned for a template name that was not loaded.
+var ErrUnknownTemplate = errors.New("unknown template")
+
+var errNoTemplateBody = errors.New("needs a .txt.tmpl or .html.tmpl body")
+
+// TemplateError reports a template that failed to load or render.
+type TemplateError struct {
+	Name string
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("template %q: %v", e.Name, e.Err)
+}
+
+func (e *TemplateError) Unwrap() []error {
+	return []error{ErrTemplate, e.Err}
+}
+
+// ErrInvalidAddress is matched by every AddressError.
+var ErrInvalidAddress = errors.New("invalid email address")
+
+var errNoRecipients = errors.New("at least one recipient is required")
+
+// AddressError reports a form field whose address list does not parse.
+type AddressError struct {
+	Field string
+	Input string
+	Err   error
+}
+
+func (e *AddressError) Error() string {
+	if e.Input == "" {
+		return fmt.Sprintf("%s: %v", e.Field, e.Err)
+	}
+	return fmt.Sprintf("%s: %q: %v", e.Field, e.Input, e.Err)
+}
+
+func (e *AddressError) Unwrap() []error {
+	return []error{ErrInvalidAddress, e.Err}
+}
+
+// ErrArchiveTooLarge is wrapped by ArchiveTooLargeError.
+var ErrArchiveTooLarge = errors.New("archive too large")
+
+// ArchiveTooLargeError reports an archive that grew past the size it may
+// have as an email attachment.
+type ArchiveTooLargeError struct {
+	Limit int64
+}
+
+func (e *ArchiveTooLargeError) Error() string {
+	return fmt.Sprintf("%s: more than %d bytes", ErrArchiveTooLarge, e.Limit)
+}
+
+func (e *ArchiveTooLargeError) Unwrap() error {
+	return ErrArchiveTooLarge
+}
+
+// ErrMimeNotAllowed is wrapped by MimeNotAllowedError.
+var ErrMimeNotAllowed = errors.New("mime type not allowed")
+
+// MimeNotAllowedError reports an upload whose detected type the mime
+// policy of the endpoint rejects.
+type MimeNotAllowedError struct {
+	Filename string
+	Detected string
+}
+
+func (e *MimeNotAllowedError) Error() string {
+	return fmt.Sprintf("%s: %q is %s", ErrMimeNotAllowed, e.Filename, e.Detected)
+}
+
+func (e *MimeNotAllowedError) Unwrap() error {
+	return ErrMimeNotAllowed
+}
+
+// ErrMalformedArchive is matched by every MalformedArchiveError.
+var ErrMalformedArchive = errors.New("malformed archive")
+
+// MalformedArchiveError reports an upload that looks like an archive of a
+// known format but cannot be read as one, e.g. a truncated zip.
+type MalformedArchiveError struct {
+	Format string
+	Err    error
+}
+
+func (e *MalformedArchiveError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", ErrMalformedArchive, e.Format, e.Err)
+}
+
+func (e *MalformedArchiveError) Unwrap() []error {
+	return []error{ErrMalformedArchive, e.Err}
+}
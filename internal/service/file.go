@@ -1,20 +1,15 @@
 package service
 
 import (
-	"archive/zip"
+	"bufio"
 	"bytes"
-	"crypto/tls"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"log/slog"
-	"mime"
-	"mime/multipart"
-	"net/http"
-	"net/smtp"
-	"os"
-	"path/filepath"
-	"regexp"
+	"net/mail"
+	"path"
 	"strings"
 
 	"doodocsbackendchallenge/internal/config"
@@ -25,228 +20,268 @@ import (
 )
 
 type FileService struct {
-	log *slog.Logger
-	cfg *config.Config
+	log       *slog.Logger
+	cfg       *config.Config
+	readers   []ArchiveReader
+	mailer    Mailer
+	templates *Templates
 }
 
 type File interface {
-	UploadFileGetJSON(f multipart.File, header *multipart.FileHeader) (models.Archive, error)
-	ArchiveInFiles(files []*multipart.FileHeader) (*bytes.Buffer, error)
-	GetEmailAndFileSendEmail(emails []string, file io.Reader, filename string) error
+	UploadFileGetJSON(file *Upload) (models.Archive, error)
+	ArchiveInFiles(w io.Writer, files Uploads, format ArchiveFormat) error
 }
 
-func newFileService(log *slog.Logger, cfg *config.Config) *FileService {
+func newFileService(log *slog.Logger, cfg *config.Config, mailer Mailer) *FileService {
 	return &FileService{
-		log: log,
-		cfg: cfg,
+		log:     log,
+		cfg:     cfg,
+		readers: DefaultArchiveReaders(),
+		mailer:  mailer,
 	}
 }
 
-type mygmail struct {
-	email    string
-	password string
-}
-
-func (flsrv *FileService) UploadFileGetJSON(f multipart.File, header *multipart.FileHeader) (models.Archive, error) {
+// UploadFileGetJSON reads the uploaded archive as it arrives and reports
+// its members. Only formats without a streaming reader are buffered.
+func (flsrv *FileService) UploadFileGetJSON(file *Upload) (models.Archive, error) {
 	const op = "service.UploadFileGetJSON"
 	log := flsrv.log.With(
 		slog.String("op", op),
 	)
-	zipfile, err := zip.NewReader(f, header.Size)
+	counter := &countingReader{r: file.Body}
+	br := bufio.NewReaderSize(counter, sniffSize)
+	magic, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF {
+		log.Error(err.Error())
+		return models.Archive{}, fmt.Errorf("%s: %w", op, err)
+	}
+	detected := mimetype.Detect(magic)
+	if err := checkClaimedMimetype(file.Filename, detected); err != nil {
+		log.Error(err.Error())
+		return models.Archive{}, fmt.Errorf("%s: %w", op, err)
+	}
+	reader, err := detectArchiveReader(flsrv.archiveReaders(), magic)
 	if err != nil {
 		log.Error(err.Error())
-		return models.Archive{}, fmt.Errorf("%s: %w\n", op, err)
+		return models.Archive{}, fmt.Errorf("%s: %w", op, err)
+	}
+	policy := flsrv.mimePolicies().Upload
+	if !policy.Allows(mimeNames(policy, detected)...) {
+		return models.Archive{}, fmt.Errorf("%s: %w", op, &MimeNotAllowedError{Filename: file.Filename, Detected: detected.String()})
 	}
-	archivesize := float64(header.Size)
-	files, totalarchivesize, err := getFileinArchive(zipfile)
+	files, totalarchivesize, totalfiles, err := getFileinArchive(reader, br)
 	if err != nil {
-		return models.Archive{}, fmt.Errorf("%s: %w\n", op, err)
+		log.Error(err.Error(), slog.String("format", reader.Format()))
+		var unsafe *UnsafePathError
+		switch {
+		case counter.err != nil:
+			// The upload broke off; the archive may well be fine.
+			err = counter.err
+		case !errors.As(err, &unsafe):
+			err = &MalformedArchiveError{Format: reader.Format(), Err: err}
+		}
+		return models.Archive{}, fmt.Errorf("%s: %w", op, err)
+	}
+	// Stream formats stop at their end marker; the rest still counts towards the size.
+	if _, err := io.Copy(io.Discard, br); err != nil {
+		log.Error(err.Error())
+		return models.Archive{}, fmt.Errorf("%s: %w", op, err)
 	}
 	archive := models.Archive{
-		Filename:     header.Filename,
-		Archive_size: archivesize,
+		Filename:     file.Filename,
+		Archive_size: float64(counter.n),
 		Total_size:   totalarchivesize,
-		Total_files:  float64(len(zipfile.File)),
+		Total_files:  float64(totalfiles),
 		Files:        files,
 	}
 	return archive, nil
 }
 
-func isZIPFile(file multipart.File) error {
-	buffer := make([]byte, 512)
-	_, err := file.Read(buffer)
-	if err != nil {
-		return err
+// archiveReaders falls back to DefaultArchiveReaders when none were configured.
+func (flsrv *FileService) archiveReaders() []ArchiveReader {
+	if flsrv.readers == nil {
+		return DefaultArchiveReaders()
 	}
+	return flsrv.readers
+}
 
-	fileType := http.DetectContentType(buffer)
-	if fileType != "application/zip" {
-		return fmt.Errorf("Is not zip file")
+// mimePolicies falls back to config.DefaultMimePolicies when no config was given.
+func (flsrv *FileService) mimePolicies() config.MimePolicies {
+	if flsrv.cfg == nil {
+		return config.DefaultMimePolicies()
 	}
-	return nil
+	return flsrv.cfg.Mime
 }
 
-func getFileinArchive(zip *zip.Reader) ([]models.File, float64, error) {
+// getFileinArchive walks the archive in memory and returns its regular
+// files, their total uncompressed size and the number of entries.
+func getFileinArchive(reader ArchiveReader, r io.Reader) ([]models.File, float64, int, error) {
 	dest := "archive"
 	totalsizearchive := 0.0
+	totalfiles := 0
 	files := []models.File{}
-	for _, file := range zip.File {
-		fp := filepath.Join(dest, file.Name)
-
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(fp, os.ModePerm)
-			continue
-		}
-		os.MkdirAll(filepath.Dir(fp), os.ModePerm)
-		strings.HasPrefix(fp, filepath.Clean(dest)+string(os.PathSeparator))
-		rc, err := file.Open()
+	err := walkArchive(reader, r, func(entry ArchiveEntry) error {
+		name, err := cleanEntryName(entry.Name)
 		if err != nil {
-			return nil, 0.0, err
+			return err
 		}
-		defer rc.Close()
-
-		buffer := make([]byte, 512)
-		n, err := rc.Read(buffer)
-		if err != nil && err != io.EOF {
-			return nil, 0.0, err
+		totalfiles++
+		if entry.IsDir {
+			return nil
 		}
-		mtype := strings.Split(mimetype.Detect(buffer[:n]).String(), ";")[0]
-
-		fmt.Println(mtype)
-		filesize := float64(file.FileInfo().Size())
-		file := models.File{
-			File_path: fp,
+		mtype, err := detectEntryMimetype(entry.Body)
+		if err != nil {
+			return err
+		}
+		filesize := float64(entry.Size)
+		files = append(files, models.File{
+			File_path: path.Join(dest, name),
 			Size:      filesize,
 			Mimetype:  mtype,
-		}
-		files = append(files, file)
+		})
 		totalsizearchive += filesize
+		return nil
+	})
+	if err != nil {
+		return nil, 0.0, 0, err
 	}
-	return files, totalsizearchive, nil
+	return files, totalsizearchive, totalfiles, nil
 }
 
-func (flsrv *FileService) ArchiveInFiles(files []*multipart.FileHeader) (*bytes.Buffer, error) {
-	buf := new(bytes.Buffer)
-	const op = "service.ArchiveInFiles"
-	zipWriter := zip.NewWriter(buf)
-	defer zipWriter.Close()
-	for _, file := range files {
-		log.Printf("%s: %s", op, filepath.Ext(file.Filename))
-		mtype := strings.Split(mime.TypeByExtension(filepath.Ext(file.Filename)), ";")[0]
-		log.Printf("%s: %s", op, mtype)
-		switch mtype {
-		case "application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/xml", "image/jpeg", "image/png":
-			src, err := file.Open()
-			if err != nil {
-				log.Println(err)
-				return nil, fmt.Errorf("%s: %w\n", op, err)
-			}
-			defer src.Close()
-
-			zipEntry, err := zipWriter.Create(file.Filename)
-			if err != nil {
-				log.Println(err)
-				return nil, fmt.Errorf("%s: %w\n", op, err)
-			}
+// detectEntryMimetype sniffs the first 512 bytes of an archive entry.
+func detectEntryMimetype(r io.Reader) (string, error) {
+	buffer := make([]byte, 512)
+	n, err := io.ReadFull(r, buffer)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return strings.Split(mimetype.Detect(buffer[:n]).String(), ";")[0], nil
+}
 
-			_, err = io.Copy(zipEntry, src)
-			if err != nil {
-				log.Println(err)
-				return nil, fmt.Errorf("%s: %w\n", op, err)
-			}
-		default:
-			return nil, fmt.Errorf("%s: %s\n", op, "Wrong mime type")
-		}
+// cleanEntryName normalizes an archive entry name and rejects names that
+// are absolute or climb out of the archive root.
+func cleanEntryName(name string) (string, error) {
+	n := strings.ReplaceAll(name, "\\", "/")
+	if n == "" || strings.HasPrefix(n, "/") || (len(n) >= 2 && n[1] == ':') {
+		return "", &UnsafePathError{Name: name}
 	}
-	if err := zipWriter.Close(); err != nil {
-		log.Printf("%s: %v", op, err)
-		return nil, fmt.Errorf("%s: %w\n", op, err)
+	for _, part := range strings.Split(n, "/") {
+		if part == ".." {
+			return "", &UnsafePathError{Name: name}
+		}
 	}
-	return buf, nil
+	return path.Clean(n), nil
 }
 
-func (flsrv *FileService) GetEmailAndFileSendEmail(emails []string, file io.Reader, filename string) error {
-	mtype := mime.TypeByExtension(filepath.Ext(filename))
-	const op = "service.getemailsandfilesendemail"
-	switch mtype {
-	case "application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/pdf":
-		smtpstruct := struct {
-			smtpServer string
-			smtpPort   string
-		}{
-			smtpServer: "smtp.gmail.com",
-			smtpPort:   "587",
+// ArchiveInFiles streams the uploads into w as an archive of the given
+// format. Nothing is written to w until the first upload passes the mime
+// check, so callers can still report early failures as a regular response.
+func (flsrv *FileService) ArchiveInFiles(w io.Writer, files Uploads, format ArchiveFormat) error {
+	return flsrv.archiveFiles(w, files, format, flsrv.mimePolicies().Archive)
+}
+
+// archiveFiles streams files into an archive, rejecting any file the
+// policy does not allow.
+func (flsrv *FileService) archiveFiles(w io.Writer, files Uploads, format ArchiveFormat, policy config.MimePolicy) error {
+	const op = "service.ArchiveInFiles"
+	log := flsrv.log.With(
+		slog.String("op", op),
+	)
+	writer, err := format.newWriter(w)
+	if err != nil {
+		log.Error(err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer writer.Abort()
+	for {
+		file, err := files.Next()
+		if err == io.EOF {
+			break
 		}
-		auth, err := startsmtp(smtpstruct, flsrv.cfg)
 		if err != nil {
-			log.Printf("%s: %v\n", op, err)
-			return fmt.Errorf("%s: %v\n", op, err)
+			log.Error(err.Error())
+			return fmt.Errorf("%s: %w", op, err)
 		}
+		detected, body, err := sniffUpload(file.Filename, file.Body)
+		if err != nil {
+			log.Error(err.Error())
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		log.Debug("archiving file", slog.String("filename", file.Filename), slog.String("mimetype", detected.String()))
+		switch {
+		case policy.Allows(mimeNames(policy, detected)...):
+			entry, err := writer.Create(file.Filename, file.Size)
+			if err != nil {
+				log.Error(err.Error())
+				return fmt.Errorf("%s: %w", op, err)
+			}
 
-		if err := getemail(emails, smtpstruct, filename, file, auth); err != nil {
-			log.Printf("%s: %v\n", op, err)
-			return fmt.Errorf("%s: %v\n", op, err)
+			_, err = io.Copy(entry, body)
+			if err != nil {
+				log.Error(err.Error())
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		default:
+			return fmt.Errorf("%s: %w", op, &MimeNotAllowedError{Filename: file.Filename, Detected: detected.String()})
 		}
 	}
+	if err := writer.Close(); err != nil {
+		log.Error(err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
 	return nil
 }
 
-func startsmtp(smtpstruct struct {
-	smtpServer string
-	smtpPort   string
-},
-	config *config.Config,
-) (smtp.Auth, error) {
-	auth := smtp.PlainAuth("", config.Email, config.Password, smtpstruct.smtpServer)
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: false,
-		ServerName:         smtpstruct.smtpServer,
-	}
-	client, err := smtp.Dial(smtpstruct.smtpServer + ":" + smtpstruct.smtpPort)
-	if err != nil {
-		return nil, err
+// mailWorkers bounds how many messages are sent at once.
+func (flsrv *FileService) mailWorkers() int {
+	if flsrv.cfg.Mailer.Workers > 0 {
+		return flsrv.cfg.Mailer.Workers
 	}
-	defer client.Quit()
-	err = client.StartTLS(tlsConfig)
-	if err != nil {
-		return nil, err
+	return config.DefaultMailer().Workers
+}
+
+// sender is the From address of outgoing mail.
+func (flsrv *FileService) sender() string {
+	if flsrv.cfg.SMTP.From != "" {
+		return flsrv.cfg.SMTP.From
 	}
-	err = client.Auth(auth)
+	return flsrv.cfg.SMTPUsername()
+}
+
+// deliver sends the attachments to rcpt alone, retrying temporary
+// failures. The To header lists to: rcpt itself for a To recipient, every
+// To recipient for a Cc or Bcc copy.
+func (flsrv *FileService) deliver(ctx context.Context, rcpt *mail.Address, to []*mail.Address, attachments []emailAttachment, message models.Message) (int, error) {
+	from := flsrv.sender()
+	msg, err := buildMessage(from, to, attachments, message)
 	if err != nil {
-		return nil, err
+		return 0, &PermanentError{Err: err}
 	}
-	return auth, nil
+	return sendWithRetry(ctx, flsrv.cfg.Mailer.Retry, func() error {
+		return flsrv.mailer.Send(from, []string{rcpt.Address}, msg)
+	})
 }
 
-func getemail(emails []string,
-	smtpstruct struct {
-		smtpServer string
-		smtpPort   string
-	},
-	filename string, file io.Reader, auth smtp.Auth,
-) error {
-	for _, oneemail := range emails {
-		log.Printf("email: %s\n", oneemail)
-		validEmail, err := regexp.MatchString(`[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}$`, oneemail)
-		if err != nil {
-			return err
-		}
-		if !validEmail {
-			return fmt.Errorf("wrong email")
-		}
-		e := email.NewEmail()
-		log.Println()
-		e.From = "sansskeleton415@gmail.com"
-		e.To = []string{oneemail}
-		e.Subject = "Doodocs Backend Challenge"
-		e.Text = []byte("Hello i'm testing smtp.")
-		_, fn := filepath.Split(filename)
-		log.Printf("Emails %s\n", emails)
-		e.Attach(file, fn, "application/octet-stream")
-		err = e.Send(smtpstruct.smtpServer+":"+smtpstruct.smtpPort, auth)
-		if err != nil {
-			return err
+// buildMessage renders the message addressed to to. Attachment content is
+// wrapped in a fresh reader each time, so every recipient gets all of it.
+// Bcc never reaches the headers.
+func buildMessage(from string, to []*mail.Address, attachments []emailAttachment, message models.Message) ([]byte, error) {
+	e := email.NewEmail()
+	e.From = from
+	e.To = formatAddresses(to)
+	e.Cc = message.Cc
+	e.ReplyTo = message.ReplyTo
+	e.Subject = message.Subject
+	if message.Text != "" {
+		e.Text = []byte(message.Text)
+	}
+	if message.HTML != "" {
+		e.HTML = []byte(message.HTML)
+	}
+	for _, a := range attachments {
+		if _, err := e.Attach(bytes.NewReader(a.Content), a.Filename, a.ContentType); err != nil {
+			return nil, err
 		}
 	}
-	return nil
+	return e.Bytes()
 }
@@ -1,17 +1,27 @@
 package service
 
 import (
+	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"testing"
+	"testing/iotest"
 
+	"doodocsbackendchallenge/internal/config"
 	"doodocsbackendchallenge/models"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/nwaples/rardecode/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -46,6 +56,11 @@ func createMultipartFile(buf *bytes.Buffer, filename string) (multipart.File, *m
 	return MultipartFileFromBuffer(buf), file
 }
 
+// uploadFromMultipart оборачивает файл формы в Upload
+func uploadFromMultipart(file multipart.File, header *multipart.FileHeader) *Upload {
+	return &Upload{Filename: header.Filename, Size: header.Size, Body: file}
+}
+
 // MultipartFileFromBuffer реализует интерфейс multipart.File
 type MultipartFileFromBuffermodel struct {
 	*bytes.Reader
@@ -119,7 +134,7 @@ func TestUploadFileGetJSON(t *testing.T) {
 			service := &FileService{log: logger}
 
 			// Вызываем тестируемый метод
-			result, err := service.UploadFileGetJSON(file, header)
+			result, err := service.UploadFileGetJSON(uploadFromMultipart(file, header))
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -132,43 +147,6 @@ func TestUploadFileGetJSON(t *testing.T) {
 	}
 }
 
-func TestIsZIPFile(t *testing.T) {
-	tests := []struct {
-		name    string
-		content []byte
-		wantErr bool
-	}{
-		{
-			name:    "валидный ZIP файл",
-			content: createValidZipContent(t),
-			wantErr: false,
-		},
-		{
-			name:    "невалидный файл (текст)",
-			content: []byte("это не zip файл"),
-			wantErr: true,
-		},
-		{
-			name:    "пустой файл",
-			content: []byte{},
-			wantErr: true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			file := MultipartFileFromBuffer(bytes.NewBuffer(tt.content))
-			err := isZIPFile(file)
-
-			if tt.wantErr {
-				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
-			}
-		})
-	}
-}
-
 func TestGetFileinArchive(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -207,12 +185,8 @@ func TestGetFileinArchive(t *testing.T) {
 			// Создаем тестовый zip
 			buf, _ := createTestZip(t, tt.files)
 
-			// Создаем zip.Reader
-			zipReader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
-			require.NoError(t, err)
-
 			// Вызываем тестируемую функцию
-			files, totalSize, err := getFileinArchive(zipReader)
+			files, totalSize, _, err := getFileinArchive(zipArchiveReader{}, bytes.NewReader(buf.Bytes()))
 			require.NoError(t, err)
 
 			// Проверяем результаты
@@ -229,16 +203,498 @@ func TestGetFileinArchive(t *testing.T) {
 	}
 }
 
-// createValidZipContent создает минимальный валидный ZIP-файл
-func createValidZipContent(t *testing.T) []byte {
+func TestGetFileinArchiveUnsafePaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+	}{
+		{name: "выход из корня", filename: "../evil.txt"},
+		{name: "выход из вложенной папки", filename: "folder/../../evil.txt"},
+		{name: "абсолютный путь", filename: "/etc/passwd"},
+		{name: "путь windows", filename: "..\\evil.txt"},
+		{name: "диск windows", filename: "C:/evil.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, _ := createTestZip(t, map[string][]byte{tt.filename: []byte("evil")})
+			_, _, _, err := getFileinArchive(zipArchiveReader{}, bytes.NewReader(buf.Bytes()))
+
+			var unsafeErr *UnsafePathError
+			require.ErrorAs(t, err, &unsafeErr)
+			assert.Equal(t, tt.filename, unsafeErr.Name)
+			assert.ErrorIs(t, err, ErrUnsafePath)
+		})
+	}
+}
+
+// createTestTar создает tar архив, при необходимости сжатый
+func createTestTar(t *testing.T, files map[string][]byte, compress func(io.Writer) io.WriteCloser) *bytes.Buffer {
 	buf := new(bytes.Buffer)
-	zipWriter := zip.NewWriter(buf)
-	writer, err := zipWriter.Create("test.txt")
+	var w io.Writer = buf
+	var cw io.WriteCloser
+	if compress != nil {
+		cw = compress(buf)
+		w = cw
+	}
+	tarWriter := tar.NewWriter(w)
+	for name, content := range files {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tarWriter.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	if cw != nil {
+		require.NoError(t, cw.Close())
+	}
+	return buf
+}
+
+func TestUploadFileGetJSONTarFormats(t *testing.T) {
+	files := map[string][]byte{
+		"test.txt":        []byte("test content"),
+		"folder/test.txt": []byte("content"),
+	}
+	tests := []struct {
+		name     string
+		compress func(io.Writer) io.WriteCloser
+	}{
+		{name: "tar"},
+		{name: "tar.gz", compress: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		{name: "tar.zst", compress: func(w io.Writer) io.WriteCloser {
+			zw, err := zstd.NewWriter(w)
+			require.NoError(t, err)
+			return zw
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := createTestTar(t, files, tt.compress)
+			file, header := createMultipartFile(buf, "test."+tt.name)
+			service := &FileService{log: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+
+			result, err := service.UploadFileGetJSON(uploadFromMultipart(file, header))
+			require.NoError(t, err)
+
+			assert.Equal(t, "test."+tt.name, result.Filename)
+			assert.Equal(t, float64(2), result.Total_files)
+			assert.Equal(t, float64(len("test content")+len("content")), result.Total_size)
+			assert.Len(t, result.Files, 2)
+			for _, f := range result.Files {
+				assert.Equal(t, "text/plain", f.Mimetype)
+			}
+		})
+	}
+}
+
+func TestUploadFileGetJSONUnsupportedFormat(t *testing.T) {
+	file, header := createMultipartFile(bytes.NewBufferString("это не архив"), "test.txt")
+	service := &FileService{log: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+
+	_, err := service.UploadFileGetJSON(uploadFromMultipart(file, header))
+	assert.ErrorIs(t, err, ErrUnsupportedArchive)
+}
+
+func TestUploadFileGetJSONMalformedArchive(t *testing.T) {
+	data, err := os.ReadFile("testdata/test.zip")
+	require.NoError(t, err)
+	// Обрезанный zip: сигнатура на месте, центрального каталога нет
+	file, header := createMultipartFile(bytes.NewBuffer(data[:len(data)/2]), "test.zip")
+	service := &FileService{log: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+
+	_, err = service.UploadFileGetJSON(uploadFromMultipart(file, header))
+	var malformed *MalformedArchiveError
+	require.ErrorAs(t, err, &malformed)
+	assert.Equal(t, "zip", malformed.Format)
+	assert.ErrorIs(t, err, ErrMalformedArchive)
+}
+
+func TestUploadFileGetJSONBrokenBody(t *testing.T) {
+	// Оборванное тело запроса не выдается за битый архив
+	data := createTestTar(t, map[string][]byte{"a.txt": bytes.Repeat([]byte("a"), 64<<10)}, nil).Bytes()
+	errBody := errors.New("connection reset")
+	body := io.MultiReader(bytes.NewReader(data[:len(data)/2]), iotest.ErrReader(errBody))
+	service := &FileService{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	_, err := service.UploadFileGetJSON(&Upload{Filename: "a.tar", Size: -1, Body: body})
+	assert.ErrorIs(t, err, errBody)
+	assert.NotErrorIs(t, err, ErrMalformedArchive)
+}
+
+// sevenZipWithLZMA2 собирает 7z из одного пустого LZMA2 потока
+// с заданным байтом свойств словаря
+func sevenZipWithLZMA2(dictProp byte) []byte {
+	header := []byte{
+		0x01, 0x04, // Header, MainStreamsInfo
+		0x06, 0x00, 0x01, 0x09, 0x01, 0x00, // PackInfo: один поток в 1 байт
+		0x07, 0x0b, 0x01, 0x00, // UnpackInfo: одна папка
+		0x01, 0x21, 0x21, 0x01, dictProp, // один кодер LZMA2 со свойствами
+		0x0c, 0x00, 0x00, // размеры после распаковки
+		0x00, 0x00, // конец StreamsInfo и Header
+	}
+	archive := []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c, 0x00, 0x04}
+	start := make([]byte, 20)
+	binary.LittleEndian.PutUint64(start[0:], 1)
+	binary.LittleEndian.PutUint64(start[8:], uint64(len(header)))
+	binary.LittleEndian.PutUint32(start[16:], crc32.ChecksumIEEE(header))
+	archive = binary.LittleEndian.AppendUint32(archive, crc32.ChecksumIEEE(start))
+	archive = append(archive, start...)
+	archive = append(archive, 0x00)
+	return append(archive, header...)
+}
+
+// rarWithDictionary собирает RAR5 с одним файлом, которому нужен
+// словарь 128KB << dictBits
+func rarWithDictionary(dictBits byte) []byte {
+	block := func(data ...byte) []byte {
+		data = append([]byte{byte(len(data))}, data...)
+		return append(binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(data)), data...)
+	}
+	// Флаги сжатия: метод 1, размер словаря в битах 10-13
+	comp := uint16(0x80) | uint16(dictBits)<<10
+	archive := []byte("Rar!\x1a\x07\x01\x00")
+	archive = append(archive, block(0x01, 0x00, 0x00)...)
+	archive = append(archive, block(0x02, 0x00, 0x08, 0x00, 0x00,
+		byte(comp&0x7f|0x80), byte(comp>>7), 0x00, 0x01, 'a')...)
+	return append(archive, block(0x05, 0x00, 0x00)...)
+}
+
+func TestUploadFileGetJSONLargeDictionary(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		err      error
+	}{
+		// Кадр zstd с окном 512MB и пустым последним блоком
+		{name: "Окно zstd", filename: "bomb.tar.zst", data: []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x98, 0x01, 0x00, 0x00}, err: zstd.ErrWindowSizeExceeded},
+		{name: "Словарь LZMA2 4GB", filename: "bomb.7z", data: sevenZipWithLZMA2(40), err: errSevenZipDictionary},
+		{name: "Словарь RAR 4GB", filename: "bomb.rar", data: rarWithDictionary(15), err: rardecode.ErrDictionaryTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, header := createMultipartFile(bytes.NewBuffer(tt.data), tt.filename)
+			service := &FileService{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+			_, err := service.UploadFileGetJSON(uploadFromMultipart(file, header))
+			assert.ErrorIs(t, err, ErrMalformedArchive)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestCheckSevenZipDictionaries(t *testing.T) {
+	// Словарь в 16MB, как у 7-Zip по умолчанию, пропускается, а 96MB нет
+	data := sevenZipWithLZMA2(0x18)
+	assert.NoError(t, checkSevenZipDictionaries(bytes.NewReader(data), int64(len(data))))
+
+	data = sevenZipWithLZMA2(0x1d)
+	assert.ErrorIs(t, checkSevenZipDictionaries(bytes.NewReader(data), int64(len(data))), errSevenZipDictionary)
+}
+
+func TestDetectArchiveReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		magic  []byte
+		format string
+	}{
+		{name: "zip", magic: []byte("PK\x03\x04"), format: "zip"},
+		{name: "gzip", magic: []byte{0x1f, 0x8b, 0x08}, format: "tar.gz"},
+		{name: "zstd", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, format: "tar.zst"},
+		{name: "7z", magic: []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c, 0x00, 0x04}, format: "7z"},
+		{name: "rar", magic: []byte("Rar!\x1a\x07\x01\x00"), format: "rar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := detectArchiveReader(DefaultArchiveReaders(), tt.magic)
+			require.NoError(t, err)
+			assert.Equal(t, tt.format, reader.Format())
+		})
+	}
+}
+
+// createFileHeaders собирает multipart форму и возвращает заголовки файлов
+func createFileHeaders(t *testing.T, field string, files map[string][]byte) []*multipart.FileHeader {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	for name, content := range files {
+		part, err := mw.CreateFormFile(field, name)
+		require.NoError(t, err)
+		_, err = part.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+
+	req, err := http.NewRequest(http.MethodPost, "/", body)
 	require.NoError(t, err)
-	_, err = writer.Write([]byte("test"))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	require.NoError(t, req.ParseMultipartForm(10<<20))
+	return req.MultipartForm.File[field]
+}
+
+func TestArchiveInFilesFormats(t *testing.T) {
+	files := map[string][]byte{
+		"test.jpg": []byte("\xff\xd8\xff\xe0"),
+		"test.png": []byte("\x89PNG\r\n\x1a\n"),
+	}
+	for _, name := range []string{"", "zip", "tar", "tar.gz", "tgz", "tar.zst"} {
+		t.Run("format "+name, func(t *testing.T) {
+			format, err := LookupArchiveFormat(name)
+			require.NoError(t, err)
+
+			service := &FileService{log: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+			buf := new(bytes.Buffer)
+			err = service.ArchiveInFiles(buf, FileHeaderUploads(createFileHeaders(t, "filestoarchive", files)), format)
+			require.NoError(t, err)
+
+			reader, err := detectArchiveReader(DefaultArchiveReaders(), buf.Bytes())
+			require.NoError(t, err)
+			got := map[string][]byte{}
+			err = reader.Walk(bytes.NewReader(buf.Bytes()), int64(buf.Len()), func(entry ArchiveEntry) error {
+				content, err := io.ReadAll(entry.Body)
+				got[entry.Name] = content
+				return err
+			})
+			require.NoError(t, err)
+			assert.Equal(t, files, got)
+		})
+	}
+}
+
+func TestArchiveInFilesWrongMimeWritesNothing(t *testing.T) {
+	files := createFileHeaders(t, "filestoarchive", map[string][]byte{"test.txt": []byte("text")})
+	service := &FileService{log: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+
+	buf := new(bytes.Buffer)
+	err := service.ArchiveInFiles(buf, FileHeaderUploads(files), DefaultArchiveFormat)
+	var notAllowed *MimeNotAllowedError
+	require.ErrorAs(t, err, &notAllowed)
+	assert.Equal(t, "test.txt", notAllowed.Filename)
+	assert.Zero(t, buf.Len())
+}
+
+// sliceUploads отдает файлы неизвестного размера, как при потоковом чтении формы
+type sliceUploads struct {
+	files map[string][]byte
+	names []string
+}
+
+func (u *sliceUploads) Next() (*Upload, error) {
+	if len(u.names) == 0 {
+		return nil, io.EOF
+	}
+	name := u.names[0]
+	u.names = u.names[1:]
+	return &Upload{Filename: name, Size: -1, Body: bytes.NewReader(u.files[name])}, nil
+}
+
+func TestArchiveInFilesUnknownSize(t *testing.T) {
+	files := map[string][]byte{
+		"test.jpg": []byte("\xff\xd8\xff\xe0"),
+		"test.png": []byte("\x89PNG\r\n\x1a\n"),
+	}
+	for _, name := range []string{"zip", "tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			format, err := LookupArchiveFormat(name)
+			require.NoError(t, err)
+
+			service := &FileService{log: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+			buf := new(bytes.Buffer)
+			uploads := &sliceUploads{files: files, names: []string{"test.jpg", "test.png"}}
+			require.NoError(t, service.ArchiveInFiles(buf, uploads, format))
+
+			result, err := service.UploadFileGetJSON(&Upload{Filename: "archive", Size: -1, Body: buf})
+			require.NoError(t, err)
+			assert.Equal(t, float64(2), result.Total_files)
+			assert.Equal(t, float64(len(files["test.jpg"])+len(files["test.png"])), result.Total_size)
+		})
+	}
+}
+
+func TestTarPendingEntrySpillsToFile(t *testing.T) {
+	// Файл неизвестного размера больше буфера уходит во временный файл,
+	// а в архив попадает целиком.
+	content := make([]byte, tarMemoryBuffer+12345)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	buf := new(bytes.Buffer)
+	writer, err := newTarArchiveWriter(buf)
 	require.NoError(t, err)
-	require.NoError(t, zipWriter.Close())
-	return buf.Bytes()
+	entry, err := writer.Create("big.bin", -1)
+	require.NoError(t, err)
+	for chunk := content; len(chunk) > 0; chunk = chunk[min(len(chunk), 1<<20):] {
+		_, err := entry.Write(chunk[:min(len(chunk), 1<<20)])
+		require.NoError(t, err)
+	}
+	pending := writer.(*tarArchiveWriter).pending
+	require.NotNil(t, pending.spill)
+	assert.LessOrEqual(t, pending.buf.Cap(), 2*tarMemoryBuffer)
+	require.NoError(t, writer.Close())
+	assert.Nil(t, pending.spill)
+
+	tr := tar.NewReader(buf)
+	header, err := tr.Next()
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), header.Size)
+	got, err := io.ReadAll(tr)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+}
+
+// failingUploads отдает файлы, а затем ошибку вместо io.EOF
+type failingUploads struct {
+	sliceUploads
+	err error
+}
+
+func (u *failingUploads) Next() (*Upload, error) {
+	upload, err := u.sliceUploads.Next()
+	if err == io.EOF {
+		return nil, u.err
+	}
+	return upload, err
+}
+
+// spillRecorder запоминает временный файл, в который ушла запись
+type spillRecorder struct {
+	archiveWriter
+	spill *os.File
+}
+
+func (r *spillRecorder) Create(name string, size int64) (io.Writer, error) {
+	entry, err := r.archiveWriter.Create(name, size)
+	if pending, ok := entry.(*pendingTarEntry); ok {
+		return writerFunc(func(p []byte) (int, error) {
+			n, err := pending.Write(p)
+			if pending.spill != nil {
+				r.spill = pending.spill
+			}
+			return n, err
+		}), err
+	}
+	return entry, err
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestArchiveInFilesAbortReleasesSpill(t *testing.T) {
+	// Обрыв загрузки после большого файла неизвестного размера закрывает
+	// временный файл, не дожидаясь сборщика мусора.
+	recorder := &spillRecorder{}
+	format := ArchiveFormat{Name: "tar", newWriter: func(w io.Writer) (archiveWriter, error) {
+		writer, err := newTarArchiveWriter(w)
+		recorder.archiveWriter = writer
+		return recorder, err
+	}}
+	uploads := &failingUploads{
+		sliceUploads: sliceUploads{
+			files: map[string][]byte{"big.png": append(bytes.Clone(pngSignature), make([]byte, tarMemoryBuffer)...)},
+			names: []string{"big.png"},
+		},
+		err: io.ErrUnexpectedEOF,
+	}
+	service := &FileService{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	err := service.ArchiveInFiles(io.Discard, uploads, format)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.NotNil(t, recorder.spill)
+	_, err = recorder.spill.Write([]byte("a"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestArchiveInFilesMimePolicy(t *testing.T) {
+	cfg := &config.Config{Mime: config.DefaultMimePolicies()}
+	cfg.Mime.Archive = config.MimePolicy{Allow: []string{"image/*"}, Deny: []string{"image/png"}}
+	service := &FileService{log: slog.New(slog.NewTextHandler(os.Stdout, nil)), cfg: cfg}
+
+	files := createFileHeaders(t, "filestoarchive", map[string][]byte{"test.jpg": []byte("\xff\xd8\xff\xe0")})
+	require.NoError(t, service.ArchiveInFiles(io.Discard, FileHeaderUploads(files), DefaultArchiveFormat))
+
+	files = createFileHeaders(t, "filestoarchive", map[string][]byte{"test.png": []byte("\x89PNG\r\n\x1a\n")})
+	err := service.ArchiveInFiles(io.Discard, FileHeaderUploads(files), DefaultArchiveFormat)
+	assert.ErrorIs(t, err, ErrMimeNotAllowed)
+}
+
+func TestArchiveInFilesContentSniffing(t *testing.T) {
+	docx, err := os.ReadFile("testdata/test.docx")
+	require.NoError(t, err)
+	png, err := os.ReadFile("testdata/test.png")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		filename string
+		content  []byte
+		detected string
+	}{
+		{name: "настоящий docx", filename: "test.docx", content: docx},
+		{name: "настоящий png", filename: "test.png", content: png},
+		{name: "exe под видом png", filename: "evil.png", content: []byte("MZ\x90\x00\x03\x00\x00\x00"), detected: "application/vnd.microsoft.portable-executable"},
+		{name: "png под видом jpg", filename: "test.jpg", content: png, detected: "image/png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &FileService{log: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+			files := createFileHeaders(t, "filestoarchive", map[string][]byte{tt.filename: tt.content})
+
+			err := service.ArchiveInFiles(io.Discard, FileHeaderUploads(files), DefaultArchiveFormat)
+			if tt.detected == "" {
+				require.NoError(t, err)
+				return
+			}
+			var mismatch *MimeMismatchError
+			require.ErrorAs(t, err, &mismatch)
+			assert.Equal(t, tt.filename, mismatch.Filename)
+			assert.Equal(t, tt.detected, mismatch.Detected)
+			assert.NotEqual(t, mismatch.Claimed, mismatch.Detected)
+		})
+	}
+}
+
+func TestLookupArchiveFormat(t *testing.T) {
+	format, err := LookupArchiveFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, "application/zip", format.ContentType)
+	assert.Equal(t, "archive.zip", format.Filename())
+
+	format, err = LookupArchiveFormat("TAR.ZST")
+	require.NoError(t, err)
+	assert.Equal(t, "application/zstd", format.ContentType)
+	assert.Equal(t, "archive.tar.zst", format.Filename())
+
+	_, err = LookupArchiveFormat("rar")
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+func TestUploadFileGetJSONNoFilesystemSideEffects(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	buf, _ := createTestZip(t, map[string][]byte{"folder/test.txt": []byte("content")})
+	file, header := createMultipartFile(buf, "test.zip")
+	service := &FileService{log: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+
+	_, err = service.UploadFileGetJSON(uploadFromMultipart(file, header))
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
 }
 
 type Archiver interface {
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"doodocsbackendchallenge/models"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// JobStore persists background jobs and the attachments each one sends,
+// in the order of Job.Attachments.
+// Unfinished jobs are listed oldest first so a restart resumes them in order.
+// When a job finishes, each failed recipient becomes a dead letter and the
+// attachments are kept until every dead letter of the job has been replayed.
+type JobStore interface {
+	CreateJob(job models.Job, attachments [][]byte) error
+	Job(id string) (models.Job, error)
+	UpdateJob(id string, fn func(job *models.Job)) (models.Job, error)
+	Attachments(id string) ([][]byte, error)
+	UnfinishedJobs() ([]models.Job, error)
+	DeadLetters() ([]models.DeadLetter, error)
+	ReplayDeadLetter(id string, newJob func(letter models.DeadLetter) (models.Job, error)) (models.Job, error)
+}
+
+var (
+	jobsBucket        = []byte("jobs")
+	attachmentsBucket = []byte("attachments")
+	// queueBucket indexes unfinished jobs so the runner does not scan history.
+	queueBucket           = []byte("queue")
+	deadLettersBucket     = []byte("dead_letters")
+	deadAttachmentsBucket = []byte("dead_attachments")
+)
+
+// BoltJobStore keeps jobs in a single BoltDB file. Job IDs sort by creation
+// time, so bucket order is queue order. The attachments of a job live in a
+// nested bucket named after the job.
+type BoltJobStore struct {
+	db *bolt.DB
+}
+
+func OpenBoltJobStore(path string) (*BoltJobStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{jobsBucket, attachmentsBucket, queueBucket, deadLettersBucket, deadAttachmentsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltJobStore{db: db}, nil
+}
+
+func (s *BoltJobStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltJobStore) CreateJob(job models.Job, attachments [][]byte) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		id := []byte(job.ID)
+		if err := tx.Bucket(jobsBucket).Put(id, data); err != nil {
+			return err
+		}
+		if err := putBlobs(tx.Bucket(attachmentsBucket), id, attachments); err != nil {
+			return err
+		}
+		return tx.Bucket(queueBucket).Put(id, nil)
+	})
+}
+
+func (s *BoltJobStore) Job(id string) (models.Job, error) {
+	var job models.Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrJobNotFound
+		}
+		return json.Unmarshal(data, &job)
+	})
+	return job, err
+}
+
+// UpdateJob applies fn to the stored job in one transaction. Once the job
+// is done it leaves the queue and its attachment is dropped.
+func (s *BoltJobStore) UpdateJob(id string, fn func(job *models.Job)) (models.Job, error) {
+	var job models.Job
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		key := []byte(id)
+		jobs := tx.Bucket(jobsBucket)
+		data := jobs.Get(key)
+		if data == nil {
+			return ErrJobNotFound
+		}
+		if err := json.Unmarshal(data, &job); err != nil {
+			return err
+		}
+		fn(&job)
+		job.UpdatedAt = time.Now().UTC()
+		data, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		if err := jobs.Put(key, data); err != nil {
+			return err
+		}
+		if job.Status != models.JobDone {
+			return nil
+		}
+		if err := buryFailed(tx, job); err != nil {
+			return err
+		}
+		if err := deleteBlobs(tx.Bucket(attachmentsBucket), key); err != nil {
+			return err
+		}
+		return tx.Bucket(queueBucket).Delete(key)
+	})
+	return job, err
+}
+
+// buryFailed turns the failed recipients and copies of a finished job into
+// dead letters. Without the attachments there is nothing to replay, so
+// nothing is kept.
+func buryFailed(tx *bolt.Tx, job models.Job) error {
+	attachments := getBlobs(tx.Bucket(attachmentsBucket), []byte(job.ID))
+	if job.Failed == 0 || attachments == nil {
+		return nil
+	}
+	letters := tx.Bucket(deadLettersBucket)
+	for i, d := range append(append([]models.Delivery{}, job.Recipients...), job.Copies...) {
+		if d.Status != models.DeliveryFailed {
+			continue
+		}
+		letter := models.DeadLetter{
+			ID:          fmt.Sprintf("%s-%d", job.ID, i),
+			JobID:       job.ID,
+			Email:       d.Email,
+			Name:        d.Name,
+			Attachments: job.Attachments,
+			Message:     job.Message,
+			Attempts:    d.Attempts,
+			Error:       d.Error,
+			FailedAt:    job.UpdatedAt,
+		}
+		data, err := json.Marshal(letter)
+		if err != nil {
+			return err
+		}
+		if err := letters.Put([]byte(letter.ID), data); err != nil {
+			return err
+		}
+	}
+	return putBlobs(tx.Bucket(deadAttachmentsBucket), []byte(job.ID), attachments)
+}
+
+func (s *BoltJobStore) Attachments(id string) ([][]byte, error) {
+	var attachments [][]byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		attachments = getBlobs(tx.Bucket(attachmentsBucket), []byte(id))
+		if attachments == nil {
+			return ErrJobNotFound
+		}
+		return nil
+	})
+	return attachments, err
+}
+
+// putBlobs stores blobs in order in a bucket nested under parent.
+func putBlobs(parent *bolt.Bucket, id []byte, blobs [][]byte) error {
+	b, err := parent.CreateBucketIfNotExists(id)
+	if err != nil {
+		return err
+	}
+	for i, blob := range blobs {
+		if err := b.Put([]byte(fmt.Sprintf("%08d", i)), blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getBlobs copies the blobs stored by putBlobs, or returns nil when there
+// is no such bucket. Bolt memory is only valid inside the transaction.
+func getBlobs(parent *bolt.Bucket, id []byte) [][]byte {
+	b := parent.Bucket(id)
+	if b == nil {
+		return nil
+	}
+	blobs := [][]byte{}
+	b.ForEach(func(_, blob []byte) error {
+		blobs = append(blobs, append([]byte{}, blob...))
+		return nil
+	})
+	return blobs
+}
+
+func deleteBlobs(parent *bolt.Bucket, id []byte) error {
+	if parent.Bucket(id) == nil {
+		return nil
+	}
+	return parent.DeleteBucket(id)
+}
+
+func (s *BoltJobStore) UnfinishedJobs() ([]models.Job, error) {
+	var jobs []models.Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		all := tx.Bucket(jobsBucket)
+		return tx.Bucket(queueBucket).ForEach(func(id, _ []byte) error {
+			var job models.Job
+			if err := json.Unmarshal(all.Get(id), &job); err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	return jobs, err
+}
+
+func (s *BoltJobStore) DeadLetters() ([]models.DeadLetter, error) {
+	letters := []models.DeadLetter{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(deadLettersBucket).ForEach(func(_, data []byte) error {
+			var letter models.DeadLetter
+			if err := json.Unmarshal(data, &letter); err != nil {
+				return err
+			}
+			letters = append(letters, letter)
+			return nil
+		})
+	})
+	return letters, err
+}
+
+// ReplayDeadLetter removes the dead letter and stores the job built by
+// newJob, with the original attachments, in one transaction.
+func (s *BoltJobStore) ReplayDeadLetter(id string, newJob func(letter models.DeadLetter) (models.Job, error)) (models.Job, error) {
+	var job models.Job
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		letters := tx.Bucket(deadLettersBucket)
+		data := letters.Get([]byte(id))
+		if data == nil {
+			return ErrDeadLetterNotFound
+		}
+		var letter models.DeadLetter
+		if err := json.Unmarshal(data, &letter); err != nil {
+			return err
+		}
+		deadAttachments := tx.Bucket(deadAttachmentsBucket)
+		attachments := getBlobs(deadAttachments, []byte(letter.JobID))
+		var err error
+		if job, err = newJob(letter); err != nil {
+			return err
+		}
+		if data, err = json.Marshal(job); err != nil {
+			return err
+		}
+		key := []byte(job.ID)
+		if err := tx.Bucket(jobsBucket).Put(key, data); err != nil {
+			return err
+		}
+		if err := putBlobs(tx.Bucket(attachmentsBucket), key, attachments); err != nil {
+			return err
+		}
+		if err := tx.Bucket(queueBucket).Put(key, nil); err != nil {
+			return err
+		}
+		if err := letters.Delete([]byte(id)); err != nil {
+			return err
+		}
+		// Keep the attachment while other recipients of the job are dead.
+		prefix := []byte(letter.JobID + "-")
+		if k, _ := letters.Cursor().Seek(prefix); k != nil && bytes.HasPrefix(k, prefix) {
+			return nil
+		}
+		return deleteBlobs(deadAttachments, []byte(letter.JobID))
+	})
+	return job, err
+}
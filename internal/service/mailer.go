@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"doodocsbackendchallenge/internal/config"
+)
+
+// Mailer delivers a complete RFC 5322 message to the envelope recipients.
+type Mailer interface {
+	Send(from string, to []string, msg []byte) error
+}
+
+// NewMailer builds the backend selected by cfg.Mailer.
+func NewMailer(cfg *config.Config) (Mailer, error) {
+	const op = "service.NewMailer"
+	switch cfg.Mailer.Backend {
+	case config.MailerSMTP, "":
+		mailer, err := NewSMTPMailer(cfg.SMTP, cfg.SMTPUsername(), cfg.Password, cfg.Mailer.Workers)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return mailer, nil
+	case config.MailerSendmail:
+		return &SendmailMailer{Path: cfg.Mailer.Sendmail}, nil
+	case config.MailerFile:
+		return &FileMailer{Dir: cfg.Mailer.DropDir}, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown mailer %q", op, cfg.Mailer.Backend)
+	}
+}
+
+// SMTPMailer sends through the configured relay, keeping up to poolSize
+// sessions open between messages. It is safe for concurrent use.
+type SMTPMailer struct {
+	pool *smtpPool
+}
+
+// NewSMTPMailer authenticates new sessions with the current value of
+// password, so a reloaded secret is used from the next session on.
+func NewSMTPMailer(cfg config.SMTP, username string, password config.Secret, poolSize int) (*SMTPMailer, error) {
+	if _, err := smtpAuth(cfg, username, password.Value()); err != nil {
+		return nil, err
+	}
+	return &SMTPMailer{pool: newSMTPPool(cfg, username, password, poolSize)}, nil
+}
+
+func (m *SMTPMailer) Send(from string, to []string, msg []byte) error {
+	return m.pool.send(from, to, msg)
+}
+
+// Close quits the idle sessions.
+func (m *SMTPMailer) Close() error {
+	return m.pool.Close()
+}
+
+// SendmailMailer pipes messages into a local sendmail-compatible binary.
+type SendmailMailer struct {
+	Path string
+}
+
+func (m *SendmailMailer) Send(from string, to []string, msg []byte) error {
+	// -i keeps a lone "." line from ending the message early.
+	args := append([]string{"-i", "-f", from, "--"}, to...)
+	cmd := exec.Command(m.Path, args...)
+	cmd.Stdin = bytes.NewReader(msg)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		err = fmt.Errorf("%s: %w: %s", m.Path, err, strings.TrimSpace(stderr.String()))
+		// sendmail exits with EX_TEMPFAIL when the message may be retried.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() != exTempFail {
+			return &PermanentError{Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+// exTempFail is EX_TEMPFAIL from sysexits.h.
+const exTempFail = 75
+
+// FileMailer drops every message as an .eml file into a maildir-style
+// directory: files are written to Dir/tmp and renamed into Dir/new, so
+// readers never see a partial message. The envelope is recorded in
+// X-Envelope-From and X-Envelope-To headers.
+type FileMailer struct {
+	Dir string
+}
+
+func (m *FileMailer) Send(from string, to []string, msg []byte) error {
+	tmpDir, newDir := filepath.Join(m.Dir, "tmp"), filepath.Join(m.Dir, "new")
+	for _, dir := range []string{tmpDir, newDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	name, err := uniqueMailName()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "X-Envelope-From: %s\r\n", from)
+	fmt.Fprintf(&buf, "X-Envelope-To: %s\r\n", strings.Join(to, ", "))
+	buf.Write(msg)
+	tmpPath := filepath.Join(tmpDir, name)
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(newDir, name))
+}
+
+func uniqueMailName() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%s.eml", time.Now().UnixNano(), hex.EncodeToString(b)), nil
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"doodocsbackendchallenge/internal/config"
+	"doodocsbackendchallenge/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := &FileMailer{Dir: dir}
+
+	require.NoError(t, mailer.Send("from@example.com", []string{"a@example.com", "b@example.com"}, []byte("Subject: test\r\n\r\nbody\r\n")))
+
+	files, err := filepath.Glob(filepath.Join(dir, "new", "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, "X-Envelope-From: from@example.com\r\nX-Envelope-To: a@example.com, b@example.com\r\nSubject: test\r\n\r\nbody\r\n", string(content))
+
+	tmp, err := os.ReadDir(filepath.Join(dir, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, tmp)
+}
+
+func TestSendmailMailer(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	script := filepath.Join(dir, "sendmail")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > "+out+".args\ncat > "+out+"\n"), 0o755))
+
+	mailer := &SendmailMailer{Path: script}
+	require.NoError(t, mailer.Send("from@example.com", []string{"a@example.com"}, []byte("Subject: test\r\n\r\nbody\r\n")))
+
+	args, err := os.ReadFile(out + ".args")
+	require.NoError(t, err)
+	assert.Equal(t, "-i -f from@example.com -- a@example.com\n", string(args))
+	msg, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "Subject: test\r\n\r\nbody\r\n", string(msg))
+
+	failing := &SendmailMailer{Path: filepath.Join(dir, "missing")}
+	assert.Error(t, failing.Send("from@example.com", []string{"a@example.com"}, nil))
+
+	// EX_TEMPFAIL (75) можно повторить, остальные коды выхода — нет.
+	for code, permanent := range map[string]bool{"75": false, "67": true} {
+		script := filepath.Join(dir, "exit"+code)
+		require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\ncat > /dev/null\nexit "+code+"\n"), 0o755))
+		err := (&SendmailMailer{Path: script}).Send("from@example.com", []string{"a@example.com"}, nil)
+		require.Error(t, err)
+		assert.Equal(t, permanent, isPermanent(err), "exit %s", code)
+	}
+}
+
+func TestNewMailer(t *testing.T) {
+	mailer, err := NewMailer(&config.Config{Mailer: config.Mailer{Backend: config.MailerFile, DropDir: "/tmp/drop"}})
+	require.NoError(t, err)
+	assert.IsType(t, &FileMailer{}, mailer)
+
+	mailer, err = NewMailer(&config.Config{Mailer: config.Mailer{Backend: config.MailerSendmail, Sendmail: "/usr/sbin/sendmail"}})
+	require.NoError(t, err)
+	assert.IsType(t, &SendmailMailer{}, mailer)
+
+	mailer, err = NewMailer(&config.Config{SMTP: config.DefaultSMTP()})
+	require.NoError(t, err)
+	assert.IsType(t, &SMTPMailer{}, mailer)
+
+	_, err = NewMailer(&config.Config{Mailer: config.Mailer{Backend: "pigeon"}})
+	assert.Error(t, err)
+}
+
+func TestEmailQueueFileMailer(t *testing.T) {
+	store, err := OpenBoltJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	dir := t.TempDir()
+	q := newTestQueue(t, store, &FileMailer{Dir: dir})
+	runQueue(t, q)
+	content := []byte("%PDF-1.4\n%test\n")
+	recipients := []string{"one@example.com", "two@example.com", "three@example.com"}
+
+	job, err := q.EnqueueEmail(mustRecipients(t, strings.Join(recipients, ", ")), EmailContent{}, oneUpload("doc.pdf", content), nil)
+	require.NoError(t, err)
+	job = waitJobDone(t, q, job.ID)
+	require.Len(t, job.Recipients, len(recipients))
+	for i, d := range job.Recipients {
+		assert.Equal(t, models.Delivery{Email: recipients[i], Status: models.DeliverySent, Attempts: 1}, d)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "new", "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, len(recipients))
+	// Вложение должно быть целым в каждом письме, а не только в первом.
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for _, file := range files {
+		msg, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Contains(t, string(msg), "From: sender@example.com")
+		assert.Contains(t, string(msg), "doc.pdf")
+		assert.Contains(t, string(msg), encoded)
+	}
+}
+
+func TestEmailQueueUnsupportedType(t *testing.T) {
+	store, err := OpenBoltJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	dir := t.TempDir()
+	q := newTestQueue(t, store, &FileMailer{Dir: dir})
+	runQueue(t, q)
+	recipients := mustRecipients(t, "one@example.com")
+
+	_, err = q.EnqueueEmail(recipients, EmailContent{}, oneUpload("notes.txt", []byte("plain text")), nil)
+	var notAllowed *MimeNotAllowedError
+	require.ErrorAs(t, err, &notAllowed)
+	assert.Equal(t, "notes.txt", notAllowed.Filename)
+	_, err = q.PreviewEmail(recipients, EmailContent{}, oneUpload("notes.txt", []byte("plain text")), nil)
+	assert.ErrorAs(t, err, &notAllowed)
+
+	jobs, err := store.UnfinishedJobs()
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+	files, err := filepath.Glob(filepath.Join(dir, "new", "*.eml"))
+	require.NoError(t, err)
+	assert.Empty(t, files, "неподдерживаемый тип не отправляется")
+}
+
+type flakyMailer struct {
+	fail string
+}
+
+func (m *flakyMailer) Send(from string, to []string, msg []byte) error {
+	if to[0] == m.fail {
+		return &textproto.Error{Code: 550, Msg: "mailbox unavailable"}
+	}
+	return nil
+}
+
+func TestSendEachBoundsConcurrency(t *testing.T) {
+	recipients := make([]*mail.Address, 20)
+	for i := range recipients {
+		recipients[i] = &mail.Address{Address: fmt.Sprintf("r%d@example.com", i)}
+	}
+	var inFlight, peak int32
+	deliveries := sendEach(recipients, 3, func(rcpt *mail.Address) (int, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return 1, nil
+	})
+	require.Len(t, deliveries, len(recipients))
+	for i, d := range deliveries {
+		assert.Equal(t, recipients[i].Address, d.Email, "порядок результатов совпадает с порядком получателей")
+	}
+	assert.LessOrEqual(t, peak, int32(3))
+}
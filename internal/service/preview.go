@@ -0,0 +1,58 @@
+package service
+
+import (
+	"fmt"
+
+	"doodocsbackendchallenge/models"
+)
+
+// PreviewEmail runs the checks of EnqueueEmail and renders the message,
+// but stores and sends nothing.
+func (q *EmailQueue) PreviewEmail(recipients Recipients, content EmailContent, files Uploads, archive *ArchiveFormat) (models.EmailPreview, error) {
+	const op = "service.PreviewEmail"
+	attachments, err := q.emailAttachments(recipients, files, archive)
+	if err != nil {
+		return models.EmailPreview{}, fmt.Errorf("%s: %w\n", op, err)
+	}
+	preview, err := q.files.preview(recipients, content, attachments)
+	if err != nil {
+		return models.EmailPreview{}, fmt.Errorf("%s: %w\n", op, err)
+	}
+	return preview, nil
+}
+
+// PreviewArchiveEmail is PreviewEmail for EnqueueArchiveEmail.
+func (q *EmailQueue) PreviewArchiveEmail(recipients Recipients, content EmailContent, files Uploads, format ArchiveFormat) (models.EmailPreview, error) {
+	const op = "service.PreviewArchiveEmail"
+	attachments, err := q.archiveEmailAttachments(recipients, files, format)
+	if err != nil {
+		return models.EmailPreview{}, fmt.Errorf("%s: %w\n", op, err)
+	}
+	preview, err := q.files.preview(recipients, content, attachments)
+	if err != nil {
+		return models.EmailPreview{}, fmt.Errorf("%s: %w\n", op, err)
+	}
+	return preview, nil
+}
+
+// preview builds the message to the first recipient exactly as deliver
+// would, so anything that would fail at send time fails here.
+func (flsrv *FileService) preview(recipients Recipients, content EmailContent, attachments []emailAttachment) (models.EmailPreview, error) {
+	message, err := flsrv.recipientMessage(recipients, content)
+	if err != nil {
+		return models.EmailPreview{}, err
+	}
+	from := flsrv.sender()
+	msg, err := buildMessage(from, recipients.To[:1], attachments, message)
+	if err != nil {
+		return models.EmailPreview{}, err
+	}
+	meta, _ := splitAttachments(attachments)
+	return models.EmailPreview{
+		From:        from,
+		To:          formatAddresses(recipients.To),
+		Message:     message,
+		Attachments: meta,
+		MessageSize: len(msg),
+	}, nil
+}
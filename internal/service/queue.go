@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"time"
+
+	"doodocsbackendchallenge/models"
+)
+
+type Jobs interface {
+	EnqueueEmail(recipients Recipients, content EmailContent, files Uploads, archive *ArchiveFormat) (models.Job, error)
+	EnqueueArchiveEmail(recipients Recipients, content EmailContent, files Uploads, format ArchiveFormat) (models.Job, error)
+	PreviewEmail(recipients Recipients, content EmailContent, files Uploads, archive *ArchiveFormat) (models.EmailPreview, error)
+	PreviewArchiveEmail(recipients Recipients, content EmailContent, files Uploads, format ArchiveFormat) (models.EmailPreview, error)
+	Job(id string) (models.Job, error)
+	DeadLetters() ([]models.DeadLetter, error)
+	ReplayDeadLetter(id string) (models.Job, error)
+}
+
+// EmailQueue sends email in the background. The store is the queue: a job
+// is persisted with its attachment before EnqueueEmail returns, and Run
+// works through unfinished jobs oldest first, including those left over
+// from a previous process. A recipient that was being sent to when the
+// process died is sent to again on restart. Temporary failures are
+// retried with backoff; recipients that still fail become dead letters.
+type EmailQueue struct {
+	log   *slog.Logger
+	files *FileService
+	store JobStore
+	wake  chan struct{}
+}
+
+func newEmailQueue(log *slog.Logger, files *FileService, store JobStore) *EmailQueue {
+	return &EmailQueue{
+		log:   log,
+		files: files,
+		store: store,
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// EnqueueEmail checks the attachments and the recipients, renders the
+// message, stores the job and returns it without waiting for any delivery.
+// With an archive format every file is packed into one attachment.
+func (q *EmailQueue) EnqueueEmail(recipients Recipients, content EmailContent, files Uploads, archive *ArchiveFormat) (models.Job, error) {
+	const op = "service.EnqueueEmail"
+	attachments, err := q.emailAttachments(recipients, files, archive)
+	if err != nil {
+		return models.Job{}, fmt.Errorf("%s: %w\n", op, err)
+	}
+	job, err := q.enqueue(recipients, content, attachments)
+	if err != nil {
+		return models.Job{}, fmt.Errorf("%s: %w\n", op, err)
+	}
+	return job, nil
+}
+
+// EnqueueArchiveEmail packs the files into one archive with the
+// ArchiveInFiles pipeline, so they are checked against the Archive policy,
+// and queues it like EnqueueEmail. The archive may not grow past
+// ArchiveEmail.MaxArchiveSize.
+func (q *EmailQueue) EnqueueArchiveEmail(recipients Recipients, content EmailContent, files Uploads, format ArchiveFormat) (models.Job, error) {
+	const op = "service.EnqueueArchiveEmail"
+	attachments, err := q.archiveEmailAttachments(recipients, files, format)
+	if err != nil {
+		return models.Job{}, fmt.Errorf("%s: %w\n", op, err)
+	}
+	job, err := q.enqueue(recipients, content, attachments)
+	if err != nil {
+		return models.Job{}, fmt.Errorf("%s: %w\n", op, err)
+	}
+	return job, nil
+}
+
+// emailAttachments checks email is enabled and there is someone to send to
+// before reading the attachments of EnqueueEmail.
+func (q *EmailQueue) emailAttachments(recipients Recipients, files Uploads, archive *ArchiveFormat) ([]emailAttachment, error) {
+	if q.files.mailer == nil {
+		return nil, ErrEmailDisabled
+	}
+	if len(recipients.To) == 0 {
+		return nil, &AddressError{Field: "emails", Err: errNoRecipients}
+	}
+	attachments, err := q.files.readAttachments(files, archive)
+	if err != nil {
+		q.log.Error(err.Error(), slog.String("op", "service.EmailQueue.emailAttachments"))
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// archiveEmailAttachments is emailAttachments for EnqueueArchiveEmail.
+func (q *EmailQueue) archiveEmailAttachments(recipients Recipients, files Uploads, format ArchiveFormat) ([]emailAttachment, error) {
+	if q.files.mailer == nil {
+		return nil, ErrEmailDisabled
+	}
+	if len(recipients.To) == 0 {
+		return nil, &AddressError{Field: "emails", Err: errNoRecipients}
+	}
+	policy := q.files.mimePolicies().Archive
+	attachment, err := q.files.archiveAttachment(files, format, policy, q.files.cfg.ArchiveEmail.MaxArchiveSize)
+	if err != nil {
+		q.log.Error(err.Error(), slog.String("op", "service.EmailQueue.archiveEmailAttachments"))
+		return nil, err
+	}
+	return []emailAttachment{attachment}, nil
+}
+
+// enqueue renders the message and stores the job with its attachments.
+func (q *EmailQueue) enqueue(recipients Recipients, content EmailContent, attachments []emailAttachment) (models.Job, error) {
+	message, err := q.files.recipientMessage(recipients, content)
+	if err != nil {
+		return models.Job{}, err
+	}
+	meta, blobs := splitAttachments(attachments)
+	job, err := newEmailJob(meta, message, recipients.To, recipients.copyAddresses())
+	if err != nil {
+		return models.Job{}, err
+	}
+	if err := q.store.CreateJob(job, blobs); err != nil {
+		q.log.Error(err.Error(), slog.String("op", "service.EmailQueue.enqueue"))
+		return models.Job{}, err
+	}
+	q.notify()
+	return job, nil
+}
+
+// newEmailJob is a queued job with every recipient and copy pending.
+func newEmailJob(attachments []models.Attachment, message models.Message, to, copies []*mail.Address) (models.Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return models.Job{}, err
+	}
+	now := time.Now().UTC()
+	job := models.Job{
+		ID:          id,
+		Status:      models.JobQueued,
+		Attachments: attachments,
+		Message:     message,
+		Total:       len(to) + len(copies),
+		Recipients:  pendingDeliveries(to),
+		Copies:      pendingDeliveries(copies),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	return job, nil
+}
+
+func pendingDeliveries(addrs []*mail.Address) []models.Delivery {
+	if len(addrs) == 0 {
+		return nil
+	}
+	deliveries := make([]models.Delivery, len(addrs))
+	for i, addr := range addrs {
+		deliveries[i] = models.Delivery{Email: addr.Address, Name: addr.Name, Status: models.DeliveryPending}
+	}
+	return deliveries
+}
+
+func (q *EmailQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *EmailQueue) DeadLetters() ([]models.DeadLetter, error) {
+	const op = "service.DeadLetters"
+	letters, err := q.store.DeadLetters()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w\n", op, err)
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetter queues a new job that sends the dead letter again, to
+// its address only: the copies of the original job are not sent again.
+func (q *EmailQueue) ReplayDeadLetter(id string) (models.Job, error) {
+	const op = "service.ReplayDeadLetter"
+	job, err := q.store.ReplayDeadLetter(id, func(letter models.DeadLetter) (models.Job, error) {
+		return newEmailJob(letter.Attachments, letter.Message, []*mail.Address{{Name: letter.Name, Address: letter.Email}}, nil)
+	})
+	if err != nil {
+		return models.Job{}, fmt.Errorf("%s: %w\n", op, err)
+	}
+	q.notify()
+	return job, nil
+}
+
+func (q *EmailQueue) Job(id string) (models.Job, error) {
+	const op = "service.Job"
+	job, err := q.store.Job(id)
+	if err != nil {
+		return models.Job{}, fmt.Errorf("%s: %w\n", op, err)
+	}
+	return job, nil
+}
+
+// Run processes jobs until ctx is cancelled. Deliveries in flight finish;
+// those waiting to retry stay pending and resume on the next Run. With
+// email disabled jobs are left queued.
+func (q *EmailQueue) Run(ctx context.Context) {
+	if q.files.mailer == nil {
+		<-ctx.Done()
+		return
+	}
+	for {
+		q.drain(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		}
+	}
+}
+
+func (q *EmailQueue) drain(ctx context.Context) {
+	const op = "service.EmailQueue.drain"
+	for ctx.Err() == nil {
+		jobs, err := q.store.UnfinishedJobs()
+		if err != nil {
+			q.log.Error(err.Error(), slog.String("op", op))
+			return
+		}
+		if len(jobs) == 0 {
+			return
+		}
+		if err := q.process(ctx, jobs[0]); err != nil {
+			q.log.Error(err.Error(), slog.String("op", op), slog.String("job", jobs[0].ID))
+			return
+		}
+	}
+}
+
+// process sends to every recipient and copy still pending and records each
+// outcome as soon as it is known, so GET /jobs/{id} shows progress. Errors
+// are from the store only; failed deliveries are part of the job.
+func (q *EmailQueue) process(ctx context.Context, job models.Job) error {
+	const op = "service.EmailQueue.process"
+	log := q.log.With(
+		slog.String("op", op),
+		slog.String("job", job.ID),
+	)
+	blobs, err := q.store.Attachments(job.ID)
+	var attachments []emailAttachment
+	if err == nil {
+		attachments, err = joinAttachments(job.Attachments, blobs)
+	}
+	if err != nil {
+		return q.finish(job.ID, func(d *models.Delivery) {
+			d.Status, d.Error = models.DeliveryFailed, "attachment lost: "+err.Error()
+		})
+	}
+	if _, err := q.store.UpdateJob(job.ID, func(j *models.Job) { j.Status = models.JobRunning }); err != nil {
+		return err
+	}
+	// Each To recipient gets a message addressed to it; each copy one
+	// addressed to every To recipient.
+	to := addresses(job.Recipients, "")
+	send := func(isCopy bool) func(rcpt *mail.Address) (int, error) {
+		return func(rcpt *mail.Address) (int, error) {
+			header := []*mail.Address{rcpt}
+			if isCopy {
+				header = to
+			}
+			attempts, err := q.files.deliver(ctx, rcpt, header, attachments, job.Message)
+			if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+				// Interrupted while waiting to retry: leave it pending.
+				return attempts, err
+			}
+			if _, uerr := q.store.UpdateJob(job.ID, func(j *models.Job) { recordDelivery(j, isCopy, rcpt.Address, attempts, err) }); uerr != nil {
+				log.Error(uerr.Error())
+			}
+			return attempts, err
+		}
+	}
+	sendEach(addresses(job.Recipients, models.DeliveryPending), q.files.mailWorkers(), send(false))
+	if ctx.Err() != nil {
+		return nil
+	}
+	sendEach(addresses(job.Copies, models.DeliveryPending), q.files.mailWorkers(), send(true))
+	if ctx.Err() != nil {
+		return nil
+	}
+	return q.finish(job.ID, nil)
+}
+
+// addresses lists the addresses of deliveries with the given status, or
+// of all of them when status is empty.
+func addresses(deliveries []models.Delivery, status string) []*mail.Address {
+	var addrs []*mail.Address
+	for _, d := range deliveries {
+		if status == "" || d.Status == status {
+			addrs = append(addrs, &mail.Address{Name: d.Name, Address: d.Email})
+		}
+	}
+	return addrs
+}
+
+// finish marks the job done, applying fail to recipients and copies still
+// pending.
+func (q *EmailQueue) finish(id string, fail func(d *models.Delivery)) error {
+	_, err := q.store.UpdateJob(id, func(j *models.Job) {
+		for _, deliveries := range [][]models.Delivery{j.Recipients, j.Copies} {
+			for i := range deliveries {
+				if d := &deliveries[i]; d.Status == models.DeliveryPending && fail != nil {
+					fail(d)
+					j.Failed++
+				}
+			}
+		}
+		j.Status = models.JobDone
+	})
+	return err
+}
+
+// recordDelivery stores the outcome of sending to oneemail, as a copy or
+// as a To recipient.
+func recordDelivery(job *models.Job, isCopy bool, oneemail string, attempts int, err error) {
+	deliveries := job.Recipients
+	if isCopy {
+		deliveries = job.Copies
+	}
+	for i := range deliveries {
+		d := &deliveries[i]
+		if d.Email != oneemail || d.Status != models.DeliveryPending {
+			continue
+		}
+		d.Attempts = attempts
+		if err != nil {
+			d.Status, d.Error = models.DeliveryFailed, err.Error()
+			job.Failed++
+		} else {
+			d.Status = models.DeliverySent
+			job.Sent++
+		}
+		return
+	}
+}
+
+// newJobID is a time-ordered random ID: nanoseconds then random bytes, in hex.
+func newJobID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%016x%s", time.Now().UnixNano(), hex.EncodeToString(b)), nil
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"doodocsbackendchallenge/internal/config"
+	"doodocsbackendchallenge/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestQueue(t *testing.T, store JobStore, mailer Mailer) *EmailQueue {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Config{Email: "sender@example.com", Mime: config.DefaultMimePolicies()}
+	return newEmailQueue(log, newFileService(log, cfg, mailer), store)
+}
+
+func runQueue(t *testing.T, q *EmailQueue) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func mustRecipients(t *testing.T, to string) Recipients {
+	recipients, err := ParseRecipients(to, "", "", "")
+	require.NoError(t, err)
+	return recipients
+}
+
+func oneUpload(filename string, content []byte) Uploads {
+	return MemoryUploads(&Upload{Filename: filename, Size: int64(len(content)), Body: bytes.NewReader(content)})
+}
+
+func waitJobDone(t *testing.T, q *EmailQueue, id string) models.Job {
+	var job models.Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = q.Job(id)
+		require.NoError(t, err)
+		return job.Status == models.JobDone
+	}, 5*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func TestEmailQueueEnqueueValidation(t *testing.T) {
+	store, err := OpenBoltJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	q := newTestQueue(t, store, &FileMailer{Dir: t.TempDir()})
+
+	tests := []struct {
+		name     string
+		to       Recipients
+		content  []byte
+		filename string
+	}{
+		{"Нет получателей", Recipients{}, []byte("%PDF-1.4\n%test\n"), "doc.pdf"},
+		{"Запрещённый тип вложения", mustRecipients(t, "a@example.com"), []byte("plain text"), "notes.txt"},
+		{"Расширение не совпадает с содержимым", mustRecipients(t, "a@example.com"), []byte("plain text"), "doc.pdf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := q.EnqueueEmail(tt.to, EmailContent{}, oneUpload(tt.filename, tt.content), nil)
+			assert.Error(t, err)
+		})
+	}
+	jobs, err := store.UnfinishedJobs()
+	require.NoError(t, err)
+	assert.Empty(t, jobs, "отклонённые задачи не сохраняются")
+}
+
+func TestEmailQueueProcessesJob(t *testing.T) {
+	store, err := OpenBoltJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	q := newTestQueue(t, store, &flakyMailer{fail: "bad@example.com"})
+	runQueue(t, q)
+
+	job, err := q.EnqueueEmail(mustRecipients(t, "good@example.com, bad@example.com"), EmailContent{},
+		oneUpload("doc.pdf", []byte("%PDF-1.4\n%test\n")), nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobQueued, job.Status)
+
+	job = waitJobDone(t, q, job.ID)
+	assert.Equal(t, 2, job.Total)
+	assert.Equal(t, 1, job.Sent)
+	assert.Equal(t, 1, job.Failed)
+	assert.Equal(t, []models.Delivery{
+		{Email: "good@example.com", Status: models.DeliverySent, Attempts: 1},
+		{Email: "bad@example.com", Status: models.DeliveryFailed, Attempts: 1, Error: `550 "mailbox unavailable"`},
+	}, job.Recipients)
+
+	_, err = store.Attachments(job.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound, "вложение удаляется после завершения")
+	_, err = q.Job("missing")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestEmailQueueResumesAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	dir := t.TempDir()
+
+	// Первый процесс принимает задачу, успевает отправить одно письмо и падает.
+	store, err := OpenBoltJobStore(path)
+	require.NoError(t, err)
+	q := newTestQueue(t, store, &FileMailer{Dir: dir})
+	job, err := q.EnqueueEmail(mustRecipients(t, "one@example.com, two@example.com"), EmailContent{},
+		oneUpload("doc.pdf", []byte("%PDF-1.4\n%test\n")), nil)
+	require.NoError(t, err)
+	_, err = store.UpdateJob(job.ID, func(j *models.Job) {
+		j.Status = models.JobRunning
+		recordDelivery(j, false, "one@example.com", 1, nil)
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	// Второй процесс дописывает оставшихся получателей.
+	store, err = OpenBoltJobStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+	q = newTestQueue(t, store, &FileMailer{Dir: dir})
+	runQueue(t, q)
+
+	job = waitJobDone(t, q, job.ID)
+	assert.Equal(t, 2, job.Sent)
+	files, err := filepath.Glob(filepath.Join(dir, "new", "*.eml"))
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "уже отправленным повторно не пишем")
+}
+
+// switchMailer fails one address permanently until healed.
+type switchMailer struct {
+	flakyMailer
+	healed atomic.Bool
+}
+
+func (m *switchMailer) Send(from string, to []string, msg []byte) error {
+	if m.healed.Load() {
+		return nil
+	}
+	return m.flakyMailer.Send(from, to, msg)
+}
+
+func TestEmailQueueDeadLetters(t *testing.T) {
+	store, err := OpenBoltJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	mailer := &switchMailer{flakyMailer: flakyMailer{fail: "bad@example.com"}}
+	q := newTestQueue(t, store, mailer)
+	runQueue(t, q)
+
+	job, err := q.EnqueueEmail(mustRecipients(t, "good@example.com, bad@example.com"), EmailContent{},
+		oneUpload("doc.pdf", []byte("%PDF-1.4\n%test\n")), nil)
+	require.NoError(t, err)
+	waitJobDone(t, q, job.ID)
+
+	letters, err := q.DeadLetters()
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, job.ID, letters[0].JobID)
+	assert.Equal(t, "bad@example.com", letters[0].Email)
+	assert.Equal(t, []models.Attachment{{Filename: "doc.pdf", ContentType: "application/pdf", Size: 15}}, letters[0].Attachments)
+	assert.Equal(t, `550 "mailbox unavailable"`, letters[0].Error)
+
+	// После починки получателя письмо переотправляется новой задачей.
+	mailer.healed.Store(true)
+	replayed, err := q.ReplayDeadLetter(letters[0].ID)
+	require.NoError(t, err)
+	assert.NotEqual(t, job.ID, replayed.ID)
+	replayed = waitJobDone(t, q, replayed.ID)
+	assert.Equal(t, []models.Delivery{{Email: "bad@example.com", Status: models.DeliverySent, Attempts: 1}}, replayed.Recipients)
+
+	letters, err = q.DeadLetters()
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+	_, err = q.ReplayDeadLetter("missing")
+	assert.ErrorIs(t, err, ErrDeadLetterNotFound)
+}
+
+func TestEmailQueuePreview(t *testing.T) {
+	store, err := OpenBoltJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	dir := t.TempDir()
+	q := newTestQueue(t, store, &FileMailer{Dir: dir})
+	runQueue(t, q)
+
+	pdf := []byte("%PDF-1.4\n%test\n")
+	preview, err := q.PreviewEmail(mustRecipients(t, "one@example.com, Two <two@example.com>"),
+		EmailContent{Subject: "Документы"}, oneUpload("doc.pdf", pdf), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "sender@example.com", preview.From)
+	assert.Equal(t, []string{"<one@example.com>", `"Two" <two@example.com>`}, preview.To)
+	assert.Equal(t, "Документы", preview.Message.Subject)
+	assert.Equal(t, []models.Attachment{{Filename: "doc.pdf", ContentType: "application/pdf", Size: int64(len(pdf))}}, preview.Attachments)
+	assert.Positive(t, preview.MessageSize)
+
+	zipFormat, err := LookupArchiveFormat("zip")
+	require.NoError(t, err)
+	preview, err = q.PreviewArchiveEmail(mustRecipients(t, "one@example.com"), EmailContent{},
+		oneUpload("data.xml", []byte("<?xml version=\"1.0\"?><a/>")), zipFormat)
+	require.NoError(t, err)
+	require.Len(t, preview.Attachments, 1)
+	assert.Equal(t, "archive.zip", preview.Attachments[0].Filename)
+
+	_, err = q.PreviewEmail(mustRecipients(t, "one@example.com"), EmailContent{}, oneUpload("notes.txt", []byte("plain text")), nil)
+	assert.ErrorIs(t, err, ErrMimeNotAllowed)
+	_, err = q.PreviewEmail(Recipients{}, EmailContent{}, oneUpload("doc.pdf", pdf), nil)
+	var address *AddressError
+	assert.ErrorAs(t, err, &address)
+
+	// Предпросмотр ничего не сохраняет и не отправляет.
+	jobs, err := store.UnfinishedJobs()
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+	files, err := filepath.Glob(filepath.Join(dir, "new", "*.eml"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestEmailQueueEmailDisabled(t *testing.T) {
+	store, err := OpenBoltJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	q := newTestQueue(t, store, nil)
+	runQueue(t, q)
+
+	pdf := oneUpload("doc.pdf", []byte("%PDF-1.4\n%test\n"))
+	_, err = q.EnqueueEmail(mustRecipients(t, "a@example.com"), EmailContent{}, pdf, nil)
+	assert.ErrorIs(t, err, ErrEmailDisabled)
+	_, err = q.PreviewEmail(mustRecipients(t, "a@example.com"), EmailContent{}, pdf, nil)
+	assert.ErrorIs(t, err, ErrEmailDisabled)
+}
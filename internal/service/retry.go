@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/textproto"
+	"time"
+
+	"doodocsbackendchallenge/internal/config"
+)
+
+// isPermanent reports whether retrying err cannot help: a 5xx SMTP reply
+// or an error marked with PermanentError. Anything else, including 4xx
+// replies and network failures, is treated as temporary.
+func isPermanent(err error) bool {
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		return reply.Code >= 500
+	}
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// sendWithRetry calls send until it succeeds, fails permanently or runs
+// out of attempts. It returns the number of attempts made. When ctx is
+// cancelled during a wait it returns ctx.Err() with the last error dropped.
+func sendWithRetry(ctx context.Context, retry config.MailRetry, send func() error) (int, error) {
+	attempts := max(retry.Attempts, 1)
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil || isPermanent(err) || attempt >= attempts {
+			return attempt, err
+		}
+		timer := time.NewTimer(backoff(retry, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff is the wait after the given failed attempt: exponential, capped,
+// with "equal jitter" so that recipients failing together spread out but
+// still wait at least half the nominal delay.
+func backoff(retry config.MailRetry, attempt int) time.Duration {
+	d := retry.BaseDelay
+	for i := 1; i < attempt && d < retry.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > retry.MaxDelay {
+		d = retry.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int64N(int64(d-half)+1))
+}
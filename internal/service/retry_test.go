@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"doodocsbackendchallenge/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Ответ 550", &textproto.Error{Code: 550, Msg: "no such user"}, true},
+		{"Ответ 554 в обёртке", fmt.Errorf("send: %w", &textproto.Error{Code: 554, Msg: "rejected"}), true},
+		{"Ответ 421", &textproto.Error{Code: 421, Msg: "try again later"}, false},
+		{"Ответ 451", &textproto.Error{Code: 451, Msg: "greylisted"}, false},
+		{"Сетевая ошибка", errors.New("connection reset by peer"), false},
+		{"Явно постоянная", &PermanentError{Err: errors.New("bad message")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isPermanent(tt.err))
+		})
+	}
+}
+
+func TestSendWithRetry(t *testing.T) {
+	retry := config.MailRetry{Attempts: 4, BaseDelay: time.Millisecond, MaxDelay: 4 * time.Millisecond}
+	temporary := &textproto.Error{Code: 451, Msg: "try later"}
+
+	tests := []struct {
+		name         string
+		replies      []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{"Успех с первой попытки", []error{nil}, 1, nil},
+		{"Успех после временных ошибок", []error{temporary, temporary, nil}, 3, nil},
+		{"Постоянная ошибка не повторяется", []error{&textproto.Error{Code: 550, Msg: "no such user"}}, 1, &textproto.Error{Code: 550, Msg: "no such user"}},
+		{"Попытки закончились", []error{temporary, temporary, temporary, temporary, nil}, 4, temporary},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			attempts, err := sendWithRetry(context.Background(), retry, func() error {
+				calls++
+				return tt.replies[calls-1]
+			})
+			assert.Equal(t, tt.wantAttempts, attempts)
+			assert.Equal(t, tt.wantAttempts, calls)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestSendWithRetryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	retry := config.MailRetry{Attempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	attempts, err := sendWithRetry(ctx, retry, func() error {
+		cancel()
+		return errors.New("connection refused")
+	})
+	assert.Equal(t, 1, attempts)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestBackoff(t *testing.T) {
+	retry := config.MailRetry{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, nominal := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	} {
+		for i := 0; i < 20; i++ {
+			d := backoff(retry, attempt)
+			assert.GreaterOrEqual(t, d, nominal/2, "attempt %d", attempt)
+			assert.LessOrEqual(t, d, nominal, "attempt %d", attempt)
+		}
+	}
+	assert.Zero(t, backoff(config.MailRetry{}, 3))
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"net/mail"
+	"sync"
+
+	"doodocsbackendchallenge/models"
+)
+
+// sendEach calls send once per recipient with at most workers calls in
+// flight and returns the outcomes in recipient order. send reports how
+// many attempts the delivery took.
+func sendEach(recipients []*mail.Address, workers int, send func(rcpt *mail.Address) (int, error)) []models.Delivery {
+	deliveries := make([]models.Delivery, len(recipients))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < min(max(workers, 1), len(recipients)); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				attempts, err := send(recipients[i])
+				deliveries[i] = models.Delivery{
+					Email:    recipients[i].Address,
+					Name:     recipients[i].Name,
+					Status:   models.DeliverySent,
+					Attempts: attempts,
+				}
+				if err != nil {
+					deliveries[i].Status = models.DeliveryFailed
+					deliveries[i].Error = err.Error()
+				}
+			}
+		}()
+	}
+	for i := range recipients {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return deliveries
+}
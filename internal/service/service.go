@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"log/slog"
 
 	"doodocsbackendchallenge/internal/config"
@@ -8,10 +9,22 @@ import (
 
 type Service struct {
 	File
+	Jobs
+	queue *EmailQueue
 }
 
-func NewServices(log *slog.Logger, cfg *config.Config) *Service {
+func NewServices(log *slog.Logger, cfg *config.Config, mailer Mailer, jobs JobStore, templates *Templates) *Service {
+	files := newFileService(log, cfg, mailer)
+	files.templates = templates
+	queue := newEmailQueue(log, files, jobs)
 	return &Service{
-		File: newFileService(log, cfg),
+		File:  files,
+		Jobs:  queue,
+		queue: queue,
 	}
 }
+
+// Run works through queued jobs until ctx is cancelled.
+func (s *Service) Run(ctx context.Context) {
+	s.queue.Run(ctx)
+}
@@ -0,0 +1,444 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// sevenzip allocates whatever dictionary the coder properties ask for, up
+// to 4GB, so the coders are read from the header and checked before the
+// archive is handed to it.
+
+// maxSevenZipHeader bounds an encoded header once unpacked.
+const maxSevenZipHeader = 64 << 20
+
+// 7z header property IDs.
+const (
+	szEnd                   = 0x00
+	szHeader                = 0x01
+	szArchiveProperties     = 0x02
+	szAdditionalStreamsInfo = 0x03
+	szMainStreamsInfo       = 0x04
+	szPackInfo              = 0x06
+	szUnpackInfo            = 0x07
+	szSubStreamsInfo        = 0x08
+	szSize                  = 0x09
+	szCRC                   = 0x0a
+	szFolderID              = 0x0b
+	szCodersUnpackSize      = 0x0c
+	szEncodedHeader         = 0x17
+)
+
+var (
+	szMethodCopy  = []byte{0x00}
+	szMethodLZMA  = []byte{0x03, 0x01, 0x01}
+	szMethodLZMA2 = []byte{0x21}
+
+	errSevenZipHeader     = errors.New("7z: unsupported header")
+	errSevenZipDictionary = errors.New("7z: dictionary too large")
+)
+
+type szCoder struct {
+	method []byte
+	props  []byte
+}
+
+type szFolder struct {
+	coders      []szCoder
+	unpackSizes []uint64
+}
+
+type szStreams struct {
+	packPos   uint64
+	packSizes []uint64
+	folders   []szFolder
+}
+
+// checkSevenZipDictionaries rejects archives whose LZMA or LZMA2 coders
+// need a dictionary over maxArchiveDictionary. A header it can't follow is
+// refused too, since sevenzip could still read a dictionary size from it.
+func checkSevenZipDictionaries(r io.ReaderAt, size int64) error {
+	var start [32]byte
+	if _, err := r.ReadAt(start[:], 0); err != nil {
+		// Too short for sevenzip as well.
+		return nil
+	}
+	offset := binary.LittleEndian.Uint64(start[12:20])
+	length := binary.LittleEndian.Uint64(start[20:28])
+	if length == 0 || offset > uint64(size) || length > uint64(size)-32-offset {
+		return nil
+	}
+	header := make([]byte, length)
+	if _, err := r.ReadAt(header, int64(32+offset)); err != nil {
+		return nil
+	}
+
+	id, br := header[0], bytes.NewReader(header[1:])
+	if id == szEncodedHeader {
+		streams, err := readSZStreams(br)
+		if err != nil {
+			return errSevenZipHeader
+		}
+		if err := checkSZFolders(streams.folders); err != nil {
+			return err
+		}
+		if header, err = decodeSZHeader(r, streams); err != nil || len(header) == 0 {
+			return errSevenZipHeader
+		}
+		id, br = header[0], bytes.NewReader(header[1:])
+	}
+	if id != szHeader {
+		return errSevenZipHeader
+	}
+	folders, err := readSZHeaderFolders(br)
+	if err != nil {
+		return errSevenZipHeader
+	}
+	return checkSZFolders(folders)
+}
+
+func checkSZFolders(folders []szFolder) error {
+	for _, f := range folders {
+		for _, c := range f.coders {
+			if dict := szDictionarySize(c); dict > maxArchiveDictionary {
+				return fmt.Errorf("%w: %d bytes", errSevenZipDictionary, dict)
+			}
+		}
+	}
+	return nil
+}
+
+// szDictionarySize is the dictionary a coder allocates, 0 for coders
+// without one.
+func szDictionarySize(c szCoder) int64 {
+	switch {
+	case bytes.Equal(c.method, szMethodLZMA) && len(c.props) == 5:
+		return int64(binary.LittleEndian.Uint32(c.props[1:]))
+	case bytes.Equal(c.method, szMethodLZMA2) && len(c.props) == 1:
+		p := c.props[0]
+		if p >= 40 {
+			return 1<<32 - 1
+		}
+		return int64(2|p&1) << (p/2 + 11)
+	}
+	return 0
+}
+
+// decodeSZHeader unpacks an encoded header. 7-Zip compresses headers with
+// a single LZMA coder; other chains, such as encrypted headers, are
+// refused since their folders can't be checked.
+func decodeSZHeader(r io.ReaderAt, streams szStreams) ([]byte, error) {
+	if len(streams.folders) != 1 || len(streams.packSizes) != 1 {
+		return nil, errSevenZipHeader
+	}
+	f := streams.folders[0]
+	if len(f.coders) != 1 || len(f.unpackSizes) != 1 || f.unpackSizes[0] > maxSevenZipHeader {
+		return nil, errSevenZipHeader
+	}
+	c := f.coders[0]
+	packed := bufio.NewReader(io.NewSectionReader(r, int64(32+streams.packPos), int64(streams.packSizes[0])))
+
+	var dec io.Reader
+	switch {
+	case bytes.Equal(c.method, szMethodCopy):
+		dec = packed
+	case bytes.Equal(c.method, szMethodLZMA):
+		var size [8]byte
+		binary.LittleEndian.PutUint64(size[:], f.unpackSizes[0])
+		lr, err := lzma.NewReader(io.MultiReader(bytes.NewReader(c.props), bytes.NewReader(size[:]), packed))
+		if err != nil {
+			return nil, err
+		}
+		dec = lr
+	case bytes.Equal(c.method, szMethodLZMA2):
+		lr, err := lzma.Reader2Config{DictCap: int(szDictionarySize(c))}.NewReader2(packed)
+		if err != nil {
+			return nil, err
+		}
+		dec = lr
+	default:
+		return nil, errSevenZipHeader
+	}
+	return io.ReadAll(io.LimitReader(dec, int64(f.unpackSizes[0])))
+}
+
+// readSZHeaderFolders returns the folders of the streams described by a
+// plain header, stopping before the file list.
+func readSZHeaderFolders(br *bytes.Reader) ([]szFolder, error) {
+	var folders []szFolder
+	for {
+		id, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch id {
+		case szArchiveProperties:
+			for {
+				prop, err := br.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				if prop == szEnd {
+					break
+				}
+				if err := skipSZBytes(br); err != nil {
+					return nil, err
+				}
+			}
+		case szAdditionalStreamsInfo, szMainStreamsInfo:
+			streams, err := readSZStreams(br)
+			if err != nil {
+				return nil, err
+			}
+			folders = append(folders, streams.folders...)
+		default:
+			return folders, nil
+		}
+	}
+}
+
+// readSZStreams reads a streams info block up to its substreams, which
+// carry nothing about the coders.
+func readSZStreams(br *bytes.Reader) (szStreams, error) {
+	var s szStreams
+	for {
+		id, err := br.ReadByte()
+		if err != nil {
+			return s, err
+		}
+		switch id {
+		case szPackInfo:
+			if s.packPos, err = readSZNumber(br); err != nil {
+				return s, err
+			}
+			n, err := readSZCount(br)
+			if err != nil {
+				return s, err
+			}
+			if s.packSizes, err = readSZPackSizes(br, n); err != nil {
+				return s, err
+			}
+		case szUnpackInfo:
+			if s.folders, err = readSZUnpackInfo(br); err != nil {
+				return s, err
+			}
+		case szSubStreamsInfo, szEnd:
+			return s, nil
+		default:
+			return s, errSevenZipHeader
+		}
+	}
+}
+
+func readSZPackSizes(br *bytes.Reader, n int) ([]uint64, error) {
+	var sizes []uint64
+	for {
+		id, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch id {
+		case szSize:
+			sizes = make([]uint64, n)
+			for i := range sizes {
+				if sizes[i], err = readSZNumber(br); err != nil {
+					return nil, err
+				}
+			}
+		case szCRC:
+			if err := skipSZDigests(br, n); err != nil {
+				return nil, err
+			}
+		case szEnd:
+			return sizes, nil
+		default:
+			return nil, errSevenZipHeader
+		}
+	}
+}
+
+func readSZUnpackInfo(br *bytes.Reader) ([]szFolder, error) {
+	if id, err := br.ReadByte(); err != nil || id != szFolderID {
+		return nil, errSevenZipHeader
+	}
+	n, err := readSZCount(br)
+	if err != nil {
+		return nil, err
+	}
+	if external, err := br.ReadByte(); err != nil || external != 0 {
+		return nil, errSevenZipHeader
+	}
+	folders := make([]szFolder, n)
+	outputs := make([]int, n)
+	for i := range folders {
+		if folders[i], outputs[i], err = readSZFolder(br); err != nil {
+			return nil, err
+		}
+	}
+	if id, err := br.ReadByte(); err != nil || id != szCodersUnpackSize {
+		return nil, errSevenZipHeader
+	}
+	for i := range folders {
+		folders[i].unpackSizes = make([]uint64, outputs[i])
+		for j := range folders[i].unpackSizes {
+			if folders[i].unpackSizes[j], err = readSZNumber(br); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for {
+		id, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch id {
+		case szCRC:
+			if err := skipSZDigests(br, n); err != nil {
+				return nil, err
+			}
+		case szEnd:
+			return folders, nil
+		default:
+			return nil, errSevenZipHeader
+		}
+	}
+}
+
+// readSZFolder reads one folder and returns it with its number of output
+// streams.
+func readSZFolder(br *bytes.Reader) (szFolder, int, error) {
+	var f szFolder
+	n, err := readSZCount(br)
+	if err != nil {
+		return f, 0, err
+	}
+	var inputs, outputs int
+	f.coders = make([]szCoder, n)
+	for i := range f.coders {
+		flags, err := br.ReadByte()
+		if err != nil {
+			return f, 0, err
+		}
+		if flags&0x80 != 0 {
+			return f, 0, errSevenZipHeader
+		}
+		c := &f.coders[i]
+		c.method = make([]byte, flags&0x0f)
+		if _, err := io.ReadFull(br, c.method); err != nil {
+			return f, 0, err
+		}
+		in, out := 1, 1
+		if flags&0x10 != 0 {
+			if in, err = readSZCount(br); err != nil {
+				return f, 0, err
+			}
+			if out, err = readSZCount(br); err != nil {
+				return f, 0, err
+			}
+		}
+		inputs += in
+		outputs += out
+		if flags&0x20 != 0 {
+			size, err := readSZCount(br)
+			if err != nil {
+				return f, 0, err
+			}
+			c.props = make([]byte, size)
+			if _, err := io.ReadFull(br, c.props); err != nil {
+				return f, 0, err
+			}
+		}
+	}
+	if outputs == 0 {
+		return f, 0, errSevenZipHeader
+	}
+	// Bind pairs, then the packed stream indexes when there are several.
+	bindPairs := outputs - 1
+	for i := 0; i < 2*bindPairs; i++ {
+		if _, err := readSZNumber(br); err != nil {
+			return f, 0, err
+		}
+	}
+	if packed := inputs - bindPairs; packed > 1 {
+		for i := 0; i < packed; i++ {
+			if _, err := readSZNumber(br); err != nil {
+				return f, 0, err
+			}
+		}
+	}
+	return f, outputs, nil
+}
+
+func skipSZDigests(br *bytes.Reader, n int) error {
+	allDefined, err := br.ReadByte()
+	if err != nil {
+		return err
+	}
+	defined := n
+	if allDefined == 0 {
+		bits := make([]byte, (n+7)/8)
+		if _, err := io.ReadFull(br, bits); err != nil {
+			return err
+		}
+		defined = 0
+		for i := 0; i < n; i++ {
+			if bits[i/8]&(0x80>>(i%8)) != 0 {
+				defined++
+			}
+		}
+	}
+	_, err = br.Seek(int64(defined)*4, io.SeekCurrent)
+	return err
+}
+
+func skipSZBytes(br *bytes.Reader) error {
+	n, err := readSZCount(br)
+	if err != nil {
+		return err
+	}
+	_, err = br.Seek(int64(n), io.SeekCurrent)
+	return err
+}
+
+// readSZCount reads a number used as a count or a length, bounded by what
+// is left of the header so a crafted one can't make us allocate.
+func readSZCount(br *bytes.Reader) (int, error) {
+	n, err := readSZNumber(br)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(br.Len()) {
+		return 0, errSevenZipHeader
+	}
+	return int(n), nil
+}
+
+// readSZNumber reads the 7z variable-length number: the leading one bits
+// of the first byte tell how many bytes follow.
+func readSZNumber(br *bytes.Reader) (uint64, error) {
+	first, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	var value uint64
+	mask := byte(0x80)
+	for i := 0; i < 8; i++ {
+		if first&mask == 0 {
+			high := uint64(first & (mask - 1))
+			return value | high<<(8*i), nil
+		}
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint64(b) << (8 * i)
+		mask >>= 1
+	}
+	return value, nil
+}
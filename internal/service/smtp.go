@@ -0,0 +1,249 @@
+package service
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"doodocsbackendchallenge/internal/config"
+)
+
+// smtpDialTimeout bounds connecting to the relay.
+const smtpDialTimeout = 30 * time.Second
+
+// smtpCommandTimeout bounds every read and write on a session, so a relay
+// that accepts the connection and then stalls fails the attempt instead
+// of blocking the worker, and with it the queue, forever.
+const smtpCommandTimeout = 2 * time.Minute
+
+// deadlineConn moves the deadline forward before each read and write.
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+// dialSMTP connects to the relay using the configured TLS mode and
+// authenticates when auth is not nil. Every read and write on the session,
+// the handshake included, must finish within timeout.
+func dialSMTP(cfg config.SMTP, auth smtp.Auth, timeout time.Duration) (*smtp.Client, error) {
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+	var conn net.Conn
+	var err error
+	if cfg.TLSMode == config.SMTPTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", cfg.Addr(), tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", cfg.Addr())
+	}
+	if err != nil {
+		return nil, err
+	}
+	client, err := smtp.NewClient(&deadlineConn{Conn: conn, timeout: timeout}, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if cfg.TLSMode == config.SMTPTLSStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// smtpAuth builds the configured authentication mechanism, or nil for "none".
+func smtpAuth(cfg config.SMTP, username, password string) (smtp.Auth, error) {
+	switch cfg.Auth {
+	case config.SMTPAuthPlain, "":
+		return smtp.PlainAuth("", username, password, cfg.Host), nil
+	case config.SMTPAuthLogin:
+		return &loginAuth{username: username, password: password}, nil
+	case config.SMTPAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(username, password), nil
+	case config.SMTPAuthNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown smtp auth mechanism %q", cfg.Auth)
+	}
+}
+
+// smtpIdleTimeout is how long a pooled connection may sit unused before it
+// is closed instead of reused; relays drop idle sessions on their own.
+const smtpIdleTimeout = 30 * time.Second
+
+// smtpPool keeps up to size authenticated sessions open so consecutive
+// messages skip the TCP, TLS and AUTH round trips.
+type smtpPool struct {
+	cfg      config.SMTP
+	username string
+	password config.Secret
+	size     int
+	timeout  time.Duration
+
+	mu   sync.Mutex
+	idle []*pooledClient
+}
+
+type pooledClient struct {
+	*smtp.Client
+	lastUsed time.Time
+}
+
+func newSMTPPool(cfg config.SMTP, username string, password config.Secret, size int) *smtpPool {
+	if size <= 0 {
+		size = 1
+	}
+	return &smtpPool{cfg: cfg, username: username, password: password, size: size, timeout: smtpCommandTimeout}
+}
+
+// get returns an idle session that still answers RSET, or dials a new one.
+func (p *smtpPool) get() (*pooledClient, error) {
+	for {
+		p.mu.Lock()
+		if len(p.idle) == 0 {
+			p.mu.Unlock()
+			break
+		}
+		c := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mu.Unlock()
+		if time.Since(c.lastUsed) < smtpIdleTimeout && c.Reset() == nil {
+			return c, nil
+		}
+		c.Close()
+	}
+	auth, err := smtpAuth(p.cfg, p.username, p.password.Value())
+	if err != nil {
+		return nil, err
+	}
+	client, err := dialSMTP(p.cfg, auth, p.timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &pooledClient{Client: client}, nil
+}
+
+// put returns a healthy session to the pool, or quits it when the pool is full.
+func (p *smtpPool) put(c *pooledClient) {
+	c.lastUsed = time.Now()
+	p.mu.Lock()
+	if len(p.idle) < p.size {
+		p.idle = append(p.idle, c)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	c.Quit()
+}
+
+// Close quits every idle session.
+func (p *smtpPool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+	for _, c := range idle {
+		c.Quit()
+	}
+	return nil
+}
+
+// send delivers one message over a pooled session. A session that saw an
+// SMTP reply error is still usable and goes back to the pool after RSET;
+// one that failed at the network level is closed.
+func (p *smtpPool) send(from string, to []string, msg []byte) error {
+	c, err := p.get()
+	if err != nil {
+		return err
+	}
+	err = deliverSMTP(c.Client, from, to, msg)
+	var reply *textproto.Error
+	switch {
+	case err == nil:
+		p.put(c)
+	case errors.As(err, &reply) && c.Reset() == nil:
+		p.put(c)
+	default:
+		c.Close()
+	}
+	return err
+}
+
+// deliverSMTP runs one MAIL/RCPT/DATA transaction on an open session.
+func deliverSMTP(client *smtp.Client, from string, to []string, msg []byte) error {
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// loginAuth implements the LOGIN mechanism, which net/smtp does not ship.
+// Like smtp.PlainAuth it refuses to send credentials in the clear to
+// anything but localhost.
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch string(fromServer) {
+	case "Username:", "User Name\x00":
+		return []byte(a.username), nil
+	case "Password:", "Password\x00":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
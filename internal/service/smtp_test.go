@@ -0,0 +1,154 @@
+package service
+
+import (
+	"bufio"
+	"net"
+	"net/smtp"
+	"strconv"
+	"testing"
+	"time"
+
+	"doodocsbackendchallenge/internal/config"
+
+	smtpmock "github.com/mocktools/go-smtp-mock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginAuth(t *testing.T) {
+	auth := &loginAuth{username: "user", password: "pass"}
+
+	_, _, err := auth.Start(&smtp.ServerInfo{Name: "relay.example.com"})
+	assert.Error(t, err, "credentials must not go out unencrypted")
+
+	mech, _, err := auth.Start(&smtp.ServerInfo{Name: "relay.example.com", TLS: true})
+	require.NoError(t, err)
+	assert.Equal(t, "LOGIN", mech)
+
+	resp, err := auth.Next([]byte("Username:"), true)
+	require.NoError(t, err)
+	assert.Equal(t, "user", string(resp))
+	resp, err = auth.Next([]byte("Password:"), true)
+	require.NoError(t, err)
+	assert.Equal(t, "pass", string(resp))
+	_, err = auth.Next([]byte("Token:"), true)
+	assert.Error(t, err)
+}
+
+func TestSMTPAuth(t *testing.T) {
+	for _, mech := range []string{config.SMTPAuthPlain, config.SMTPAuthLogin, config.SMTPAuthCRAMMD5} {
+		auth, err := smtpAuth(config.SMTP{Host: "relay.example.com", Auth: mech}, "user", "pass")
+		require.NoError(t, err)
+		assert.NotNil(t, auth, mech)
+	}
+	auth, err := smtpAuth(config.SMTP{Auth: config.SMTPAuthNone}, "user", "pass")
+	require.NoError(t, err)
+	assert.Nil(t, auth)
+}
+
+func TestSMTPMailerReusesSession(t *testing.T) {
+	server := smtpmock.New(smtpmock.ConfigurationAttr{MultipleMessageReceiving: true})
+	require.NoError(t, server.Start())
+	defer server.Stop()
+
+	mailer, err := NewSMTPMailer(config.SMTP{
+		Host:    "127.0.0.1",
+		Port:    server.PortNumber,
+		TLSMode: config.SMTPTLSNone,
+		Auth:    config.SMTPAuthNone,
+	}, "", config.Secret{}, 2)
+	require.NoError(t, err)
+	defer mailer.Close()
+
+	for _, rcpt := range []string{"one@example.com", "two@example.com", "three@example.com"} {
+		require.NoError(t, mailer.Send("relay@example.com", []string{rcpt}, []byte("Subject: hi\r\n\r\nbody\r\n")))
+	}
+
+	// Одна сессия: перед каждым следующим письмом клиент шлёт RSET.
+	assert.Len(t, mailer.pool.idle, 1)
+	messages := server.Messages()
+	require.Len(t, messages, 3)
+	assert.True(t, messages[0].Rset())
+	assert.True(t, messages[1].Rset())
+	assert.Equal(t, "RCPT TO:<three@example.com>", messages[2].RcpttoRequest())
+}
+
+func TestSMTPMailerReplyClasses(t *testing.T) {
+	tests := []struct {
+		name      string
+		reply     string
+		permanent bool
+	}{
+		{"Временный отказ 4xx", "452 Mailbox full, try later", false},
+		{"Постоянный отказ 5xx", "550 No such user", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := smtpmock.New(smtpmock.ConfigurationAttr{
+				MultipleMessageReceiving:  true,
+				BlacklistedRcpttoEmails:   []string{"rejected@example.com"},
+				MsgRcpttoBlacklistedEmail: tt.reply,
+			})
+			require.NoError(t, server.Start())
+			defer server.Stop()
+
+			mailer, err := NewSMTPMailer(config.SMTP{
+				Host:    "127.0.0.1",
+				Port:    server.PortNumber,
+				TLSMode: config.SMTPTLSNone,
+				Auth:    config.SMTPAuthNone,
+			}, "", config.Secret{}, 1)
+			require.NoError(t, err)
+			defer mailer.Close()
+
+			err = mailer.Send("relay@example.com", []string{"rejected@example.com"}, []byte("Subject: hi\r\n\r\nbody\r\n"))
+			require.Error(t, err)
+			assert.Equal(t, tt.permanent, isPermanent(err))
+			// Отказ сервера не рвёт сессию: она возвращается в пул.
+			assert.Len(t, mailer.pool.idle, 1)
+		})
+	}
+}
+
+func TestSMTPMailerStalledRelay(t *testing.T) {
+	// Релей принимает соединение, отвечает на EHLO и замолкает.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("220 stalled ESMTP\r\n"))
+		r := bufio.NewReader(conn)
+		r.ReadString('\n')
+		conn.Write([]byte("250 stalled\r\n"))
+		r.ReadString('\n')
+		time.Sleep(5 * time.Second)
+	}()
+
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	require.NoError(t, err)
+	portNumber, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	mailer, err := NewSMTPMailer(config.SMTP{
+		Host:    "127.0.0.1",
+		Port:    portNumber,
+		TLSMode: config.SMTPTLSNone,
+		Auth:    config.SMTPAuthNone,
+	}, "", config.Secret{}, 1)
+	require.NoError(t, err)
+	defer mailer.Close()
+	mailer.pool.timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	err = mailer.Send("relay@example.com", []string{"one@example.com"}, []byte("Subject: hi\r\n\r\nbody\r\n"))
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	// Таймаут временный: доставку можно повторить, сессия в пул не вернулась.
+	assert.False(t, isPermanent(err))
+	assert.Empty(t, mailer.pool.idle)
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"doodocsbackendchallenge/internal/config"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// sniffSize is how much of an upload is inspected to find its real type.
+// Office documents need more than 512 bytes to be told apart from plain zip.
+const sniffSize = 3072
+
+// extensionAliases maps types returned by mime.TypeByExtension to the name
+// mimetype uses for the same content.
+var extensionAliases = map[string]string{
+	"application/vnd.rar":               "application/x-rar-compressed",
+	"application/x-compressed-tar":      "application/gzip",
+	"application/x-gtar":                "application/gzip",
+	"application/x-zstd-compressed-tar": "application/zstd",
+}
+
+// claimedMimetype is the type implied by the file extension, or "" when the
+// extension is missing or unknown.
+func claimedMimetype(filename string) string {
+	mtype := strings.Split(mime.TypeByExtension(filepath.Ext(filename)), ";")[0]
+	if alias, ok := extensionAliases[mtype]; ok {
+		return alias
+	}
+	return mtype
+}
+
+// checkClaimedMimetype returns a MimeMismatchError when the content does not
+// look like what the extension claims. A detected subtype satisfies its
+// parents, so a .zip holding a docx is accepted.
+func checkClaimedMimetype(filename string, detected *mimetype.MIME) error {
+	claimed := claimedMimetype(filename)
+	if claimed == "" {
+		return nil
+	}
+	for m := detected; m != nil; m = m.Parent() {
+		if m.Is(claimed) {
+			return nil
+		}
+	}
+	return &MimeMismatchError{
+		Filename: filename,
+		Claimed:  claimed,
+		Detected: detected.String(),
+	}
+}
+
+// sniffUpload detects the type of body from its first bytes, checks it
+// against the extension and returns a reader that replays the whole body.
+func sniffUpload(filename string, body io.Reader) (*mimetype.MIME, io.Reader, error) {
+	br := bufio.NewReaderSize(body, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	detected := mimetype.Detect(head)
+	if err := checkClaimedMimetype(filename, detected); err != nil {
+		return nil, nil, err
+	}
+	return detected, br, nil
+}
+
+// mimeNames lists every name a policy may use for the detected type: the
+// type itself, its parents below application/octet-stream, and policy
+// entries that are aliases of it, e.g. application/xml for text/xml.
+func mimeNames(policy config.MimePolicy, detected *mimetype.MIME) []string {
+	names := []string{detected.String()}
+	for m := detected.Parent(); m != nil && m.Parent() != nil; m = m.Parent() {
+		names = append(names, m.String())
+	}
+	for _, entry := range append(append([]string{}, policy.Allow...), policy.Deny...) {
+		if !strings.Contains(entry, "*") && detected.Is(entry) {
+			names = append(names, entry)
+		}
+	}
+	return names
+}
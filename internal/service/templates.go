@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"doodocsbackendchallenge/models"
+)
+
+// Template file suffixes. A template named "welcome" is made of
+// welcome.subject.tmpl, welcome.txt.tmpl and welcome.html.tmpl; each part
+// is optional but at least one body must exist.
+const (
+	subjectTemplateSuffix = ".subject.tmpl"
+	textTemplateSuffix    = ".txt.tmpl"
+	htmlTemplateSuffix    = ".html.tmpl"
+)
+
+type emailTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// Templates are the email templates of one directory, parsed at startup.
+// Missing variables are errors rather than "<no value>".
+type Templates struct {
+	byName map[string]*emailTemplate
+}
+
+// LoadTemplates parses every template in dir. An empty dir yields no
+// templates.
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{byName: map[string]*emailTemplate{}}
+	if dir == "" {
+		return t, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		var name string
+		var parse func(tmpl *emailTemplate, src string) error
+		switch fn := entry.Name(); {
+		case strings.HasSuffix(fn, subjectTemplateSuffix):
+			name = strings.TrimSuffix(fn, subjectTemplateSuffix)
+			parse = func(tmpl *emailTemplate, src string) (err error) {
+				tmpl.subject, err = texttemplate.New(fn).Option("missingkey=error").Parse(src)
+				return err
+			}
+		case strings.HasSuffix(fn, textTemplateSuffix):
+			name = strings.TrimSuffix(fn, textTemplateSuffix)
+			parse = func(tmpl *emailTemplate, src string) (err error) {
+				tmpl.text, err = texttemplate.New(fn).Option("missingkey=error").Parse(src)
+				return err
+			}
+		case strings.HasSuffix(fn, htmlTemplateSuffix):
+			name = strings.TrimSuffix(fn, htmlTemplateSuffix)
+			parse = func(tmpl *emailTemplate, src string) (err error) {
+				tmpl.html, err = htmltemplate.New(fn).Option("missingkey=error").Parse(src)
+				return err
+			}
+		default:
+			continue
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		tmpl, ok := t.byName[name]
+		if !ok {
+			tmpl = &emailTemplate{}
+			t.byName[name] = tmpl
+		}
+		if err := parse(tmpl, string(src)); err != nil {
+			return nil, &TemplateError{Name: name, Err: err}
+		}
+	}
+	for name, tmpl := range t.byName {
+		if tmpl.text == nil && tmpl.html == nil {
+			return nil, &TemplateError{Name: name, Err: errNoTemplateBody}
+		}
+	}
+	return t, nil
+}
+
+// Render executes the named template. Parts without a template file are
+// left empty.
+func (t *Templates) Render(name string, vars map[string]any) (models.Message, error) {
+	var tmpl *emailTemplate
+	if t != nil {
+		tmpl = t.byName[name]
+	}
+	if tmpl == nil {
+		return models.Message{}, &TemplateError{Name: name, Err: ErrUnknownTemplate}
+	}
+	var msg models.Message
+	var buf bytes.Buffer
+	if tmpl.subject != nil {
+		if err := tmpl.subject.Execute(&buf, vars); err != nil {
+			return models.Message{}, &TemplateError{Name: name, Err: err}
+		}
+		msg.Subject = buf.String()
+		buf.Reset()
+	}
+	if tmpl.text != nil {
+		if err := tmpl.text.Execute(&buf, vars); err != nil {
+			return models.Message{}, &TemplateError{Name: name, Err: err}
+		}
+		msg.Text = buf.String()
+		buf.Reset()
+	}
+	if tmpl.html != nil {
+		if err := tmpl.html.Execute(&buf, vars); err != nil {
+			return models.Message{}, &TemplateError{Name: name, Err: err}
+		}
+		msg.HTML = buf.String()
+	}
+	return msg, nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"io"
+	"log/slog"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"doodocsbackendchallenge/internal/config"
+	"doodocsbackendchallenge/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTemplates(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, src := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644))
+	}
+	return dir
+}
+
+func TestLoadTemplates(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"welcome.subject.tmpl": "Hello, {{.name}}\n",
+		"welcome.txt.tmpl":     "Hi {{.name}}, your file is attached.",
+		"welcome.html.tmpl":    "<p>Hi {{.name}}</p>",
+		"plain.txt.tmpl":       "Nothing to fill in.",
+		"README.md":            "not a template",
+	})
+	templates, err := LoadTemplates(dir)
+	require.NoError(t, err)
+
+	msg, err := templates.Render("welcome", map[string]any{"name": "<Bob>"})
+	require.NoError(t, err)
+	assert.Equal(t, models.Message{
+		Subject: "Hello, <Bob>\n",
+		Text:    "Hi <Bob>, your file is attached.",
+		HTML:    "<p>Hi &lt;Bob&gt;</p>",
+	}, msg, "html/template экранирует переменные, text/template — нет")
+
+	msg, err = templates.Render("plain", nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.Message{Text: "Nothing to fill in."}, msg)
+
+	tests := []struct {
+		name     string
+		template string
+		vars     map[string]any
+		want     error
+	}{
+		{"Неизвестный шаблон", "missing", nil, ErrUnknownTemplate},
+		{"Путь вместо имени", "../welcome", nil, ErrUnknownTemplate},
+		{"Не хватает переменной", "welcome", map[string]any{}, ErrTemplate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := templates.Render(tt.template, tt.vars)
+			assert.ErrorIs(t, err, tt.want)
+			assert.ErrorIs(t, err, ErrTemplate)
+		})
+	}
+}
+
+func TestLoadTemplatesErrors(t *testing.T) {
+	_, err := LoadTemplates(writeTemplates(t, map[string]string{"broken.txt.tmpl": "{{.name"}))
+	assert.ErrorIs(t, err, ErrTemplate)
+
+	_, err = LoadTemplates(writeTemplates(t, map[string]string{"headless.subject.tmpl": "Subject only"}))
+	assert.ErrorIs(t, err, ErrTemplate, "шаблон без тела")
+
+	_, err = LoadTemplates(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+
+	templates, err := LoadTemplates("")
+	require.NoError(t, err)
+	_, err = templates.Render("welcome", nil)
+	assert.ErrorIs(t, err, ErrUnknownTemplate)
+}
+
+func TestComposeMessage(t *testing.T) {
+	templates, err := LoadTemplates(writeTemplates(t, map[string]string{
+		"report.subject.tmpl": "Report {{.month}}",
+		"report.txt.tmpl":     "Report for {{.month}}",
+	}))
+	require.NoError(t, err)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	flsrv := newFileService(log, &config.Config{}, nil)
+	flsrv.templates = templates
+
+	tests := []struct {
+		name    string
+		content EmailContent
+		want    models.Message
+	}{
+		{"Пустой запрос", EmailContent{}, models.Message{Subject: defaultSubject, Text: defaultText}},
+		{"Только HTML", EmailContent{HTML: "<b>hi</b>"}, models.Message{Subject: defaultSubject, HTML: "<b>hi</b>"}},
+		{
+			"Шаблон с переменными",
+			EmailContent{Template: "report", Variables: map[string]any{"month": "May"}},
+			models.Message{Subject: "Report May", Text: "Report for May"},
+		},
+		{
+			"Явная тема важнее шаблона",
+			EmailContent{Subject: "Custom", Template: "report", Variables: map[string]any{"month": "May"}},
+			models.Message{Subject: "Custom", Text: "Report for May"},
+		},
+		{
+			"Перенос строки в теме",
+			EmailContent{Subject: "Hi\r\nBcc: victim@example.com", Text: "x"},
+			models.Message{Subject: "Hi Bcc: victim@example.com", Text: "x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := flsrv.composeMessage(tt.content)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, msg)
+		})
+	}
+}
+
+func TestBuildMessageAlternative(t *testing.T) {
+	msg, err := buildMessage("from@example.com", []*mail.Address{{Address: "to@example.com"}},
+		[]emailAttachment{{Attachment: models.Attachment{Filename: "doc.pdf", ContentType: "application/pdf"}, Content: []byte("%PDF-1.4\n")}},
+		models.Message{Subject: "Both", Text: "plain part", HTML: "<p>html part</p>"})
+	require.NoError(t, err)
+	raw := string(msg)
+	assert.Contains(t, raw, "Subject: Both")
+	assert.Contains(t, raw, "multipart/alternative")
+	assert.Less(t, strings.Index(raw, "text/plain"), strings.Index(raw, "text/html"), "text/plain goes first")
+	assert.Contains(t, raw, "plain part")
+	assert.Contains(t, raw, "<p>html part</p>")
+	assert.Contains(t, raw, "doc.pdf")
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"io"
+	"mime/multipart"
+)
+
+// Upload is one file received from a client. Size is -1 when the length
+// is not known in advance. Body is only valid until the next call to Next.
+type Upload struct {
+	Filename string
+	Size     int64
+	Body     io.Reader
+}
+
+// Uploads yields uploaded files one at a time so the service can process
+// them without holding the whole batch in memory. Next returns io.EOF
+// after the last file.
+type Uploads interface {
+	Next() (*Upload, error)
+}
+
+type fileHeaderUploads struct {
+	files   []*multipart.FileHeader
+	current multipart.File
+}
+
+// FileHeaderUploads adapts the files of a parsed multipart form to Uploads.
+// Each file is opened lazily and closed when the next one is requested.
+func FileHeaderUploads(files []*multipart.FileHeader) Uploads {
+	return &fileHeaderUploads{files: files}
+}
+
+func (u *fileHeaderUploads) Next() (*Upload, error) {
+	if u.current != nil {
+		u.current.Close()
+		u.current = nil
+	}
+	if len(u.files) == 0 {
+		return nil, io.EOF
+	}
+	header := u.files[0]
+	u.files = u.files[1:]
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	u.current = file
+	return &Upload{Filename: header.Filename, Size: header.Size, Body: file}, nil
+}
+
+type memoryUploads []*Upload
+
+// MemoryUploads yields files that are already read, in order.
+func MemoryUploads(files ...*Upload) Uploads {
+	uploads := memoryUploads(files)
+	return &uploads
+}
+
+func (u *memoryUploads) Next() (*Upload, error) {
+	if len(*u) == 0 {
+		return nil, io.EOF
+	}
+	next := (*u)[0]
+	*u = (*u)[1:]
+	return next, nil
+}
+
+// countingReader counts the bytes read through it and keeps the first
+// error other than io.EOF, so a broken body can be told apart from a
+// broken archive.
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err != nil && err != io.EOF && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,9 @@
+package models
+
+// Attachment describes a file sent with an email. ContentType is detected
+// from the content, not taken from the client.
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Delivery statuses.
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+)
+
+type Delivery struct {
+	Email    string `json:"email"`
+	Name     string `json:"name,omitempty"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// DeadLetter is a delivery that failed for good. It keeps what is needed
+// to replay it as a new job.
+type DeadLetter struct {
+	ID          string       `json:"id"`
+	JobID       string       `json:"job_id"`
+	Email       string       `json:"email"`
+	Name        string       `json:"name,omitempty"`
+	Attachments []Attachment `json:"attachments"`
+	Message     Message      `json:"message"`
+	Attempts    int          `json:"attempts"`
+	Error       string       `json:"error"`
+	FailedAt    time.Time    `json:"failed_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Job statuses.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+)
+
+// Job is an email send processed in the background. Recipients holds the
+// delivery state of every To address and Copies that of every Cc and Bcc
+// address, pending until it has been tried. Total, Sent and Failed count
+// both.
+type Job struct {
+	ID          string       `json:"id"`
+	Status      string       `json:"status"`
+	Attachments []Attachment `json:"attachments"`
+	Message     Message      `json:"message"`
+	Total       int          `json:"total"`
+	Sent        int          `json:"sent"`
+	Failed      int          `json:"failed"`
+	Recipients  []Delivery   `json:"recipients"`
+	Copies      []Delivery   `json:"copies,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
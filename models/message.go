@@ -0,0 +1,13 @@
+package models
+
+// Message is what every email of a job shares: the content and the copy
+// recipients. Addresses are RFC 5322 formatted, display names included. A
+// message with both Text and HTML is sent as multipart/alternative.
+type Message struct {
+	Subject string   `json:"subject"`
+	Text    string   `json:"text,omitempty"`
+	HTML    string   `json:"html,omitempty"`
+	Cc      []string `json:"cc,omitempty"`
+	Bcc     []string `json:"bcc,omitempty"`
+	ReplyTo []string `json:"reply_to,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// EmailPreview is what a dry run would send: one message per To address,
+// alike but for the To header, and one copy per Cc and Bcc address.
+// MessageSize is the encoded size of the message to the first address.
+type EmailPreview struct {
+	From        string       `json:"from"`
+	To          []string     `json:"to"`
+	Message     Message      `json:"message"`
+	Attachments []Attachment `json:"attachments"`
+	MessageSize int          `json:"message_size"`
+}